@@ -0,0 +1,61 @@
+package ollamaurl
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// ErrAntiBotChallenge is returned when a registry, or a proxy in front of it,
+// answers with a challenge page for browsers instead of the manifest or blob
+var ErrAntiBotChallenge = errors.New("the registry returned an anti-bot challenge page, try a different registry or set a User-Agent")
+
+// challengeMarkers are found in the challenge pages of Cloudflare and similar services
+var challengeMarkers = [][]byte{
+	[]byte("cf-chl-"),
+	[]byte("challenge-platform"),
+	[]byte("cf-browser-verification"),
+	[]byte("Just a moment..."),
+	[]byte("Attention Required!"),
+	[]byte("DDoS protection by"),
+}
+
+// maxChallengeBytes is how much of an HTML body is searched for the markers
+const maxChallengeBytes = 64 * 1024
+
+// isHTML reports if the response claims to be an HTML page
+func isHTML(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "text/html"
+}
+
+// isChallenge reports if a response, with the start of its body, looks like an anti-bot challenge
+func isChallenge(resp *http.Response, body []byte) bool {
+	if resp.Header.Get("Cf-Mitigated") == "challenge" {
+		return true
+	}
+	if !isHTML(resp) {
+		return false
+	}
+	for _, marker := range challengeMarkers {
+		if bytes.Contains(body, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkChallenge reads the start of an HTML error response and returns ErrAntiBotChallenge if it
+// is a challenge page. The body is not usable afterwards, so this is only for failed requests.
+func checkChallenge(resp *http.Response) error {
+	var body []byte
+	if isHTML(resp) {
+		body, _ = io.ReadAll(io.LimitReader(resp.Body, maxChallengeBytes))
+	}
+	if isChallenge(resp, body) {
+		return ErrAntiBotChallenge
+	}
+	return nil
+}
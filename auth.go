@@ -0,0 +1,262 @@
+package ollamaurl
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxTokenResponseSize is more than enough for any token endpoint response
+const maxTokenResponseSize = 1 << 20
+
+// ErrUnauthorized is returned, wrapped, when the registry refuses the credentials, or when its
+// token endpoint refuses to hand out a token. This holds for every repository on the registry.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// credentials are a username and password for basic auth
+type credentials struct {
+	username string
+	password string
+}
+
+// bearerChallenge is a parsed "Www-Authenticate: Bearer realm=...,service=...,scope=..." header
+type bearerChallenge struct {
+	realm   string
+	service string
+	scope   string
+}
+
+// tokenKey identifies the token that a challenge asks for
+func (b bearerChallenge) tokenKey() string {
+	return b.realm + " " + b.service + " " + b.scope
+}
+
+// parseBearerChallenge parses a Www-Authenticate header, and reports false if it is not a
+// bearer challenge with a realm. Values may be quoted, and quoted values may contain commas.
+func parseBearerChallenge(header string) (bearerChallenge, bool) {
+	scheme, params, _ := strings.Cut(strings.TrimSpace(header), " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return bearerChallenge{}, false
+	}
+	var challenge bearerChallenge
+	for params = strings.TrimSpace(params); params != ""; {
+		var key, value string
+		key, params, _ = strings.Cut(params, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if strings.HasPrefix(params, `"`) {
+			end := strings.Index(params[1:], `"`)
+			if end < 0 {
+				return bearerChallenge{}, false
+			}
+			value, params = params[1:end+1], params[end+2:]
+			_, params, _ = strings.Cut(params, ",")
+		} else {
+			value, params, _ = strings.Cut(params, ",")
+		}
+		params = strings.TrimSpace(params)
+		switch key {
+		case "realm":
+			challenge.realm = strings.TrimSpace(value)
+		case "service":
+			challenge.service = strings.TrimSpace(value)
+		case "scope":
+			challenge.scope = strings.TrimSpace(value)
+		}
+	}
+	return challenge, challenge.realm != ""
+}
+
+// repositoryScope returns the pull scope for a registry URL like /v2/<repository>/blobs/<digest>,
+// which is the scope that registries ask for when challenging requests for that repository
+func repositoryScope(base, u *url.URL) string {
+	p := strings.TrimPrefix(u.Path, strings.TrimSuffix(base.Path, "/"))
+	p, found := strings.CutPrefix(p, "/v2/")
+	if !found {
+		return ""
+	}
+	for _, kind := range []string{"/manifests/", "/blobs/", "/referrers/", "/tags/"} {
+		if i := strings.LastIndex(p, kind); i > 0 {
+			return "repository:" + p[:i] + ":pull"
+		}
+	}
+	return ""
+}
+
+// scopeKey identifies the token for a scope on the given registry host
+func scopeKey(host, scope string) string {
+	return host + " " + scope
+}
+
+// cachedToken returns a token that was fetched earlier for the repository of the request, if any
+func (c *Client) cachedToken(req *http.Request) string {
+	for _, base := range c.registries() {
+		if base.Host != req.URL.Host {
+			continue
+		}
+		if scope := repositoryScope(base, req.URL); scope != "" {
+			c.tokensMu.Lock()
+			defer c.tokensMu.Unlock()
+			return c.tokens[scopeKey(req.URL.Host, scope)]
+		}
+	}
+	return ""
+}
+
+// credentialsFor returns the credentials for a registry host, if there are any
+func (c *Client) credentialsFor(host string) (credentials, bool) {
+	c.tokensMu.Lock()
+	defer c.tokensMu.Unlock()
+	creds, ok := c.credentials[host]
+	return creds, ok
+}
+
+// withAuthorization returns the request with the Authorization header that the client knows to send
+// for it so far: a bearer token for its repository, or basic auth if its host has asked for that
+func (c *Client) withAuthorization(req *http.Request) *http.Request {
+	if token := c.cachedToken(req); token != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req
+	}
+	c.tokensMu.Lock()
+	basic := c.basicHosts[req.URL.Host]
+	c.tokensMu.Unlock()
+	if creds, ok := c.credentialsFor(req.URL.Host); ok && basic {
+		req = req.Clone(req.Context())
+		req.SetBasicAuth(creds.username, creds.password)
+	}
+	return req
+}
+
+// fetchToken asks the token endpoint of a bearer challenge for a token, sending the
+// credentials for the registry host that sent the challenge as basic auth if there are any
+func (c *Client) fetchToken(ctx context.Context, challenge bearerChallenge, host string) (string, error) {
+	c.tokensMu.Lock()
+	token, found := c.tokens[challenge.tokenKey()]
+	c.tokensMu.Unlock()
+	if found {
+		return token, nil
+	}
+
+	tokenURL, err := url.Parse(challenge.realm)
+	if err != nil {
+		return "", fmt.Errorf("invalid token realm %q: %w", challenge.realm, err)
+	}
+	query := tokenURL.Query()
+	if challenge.service != "" {
+		query.Set("service", challenge.service)
+	}
+	if challenge.scope != "" {
+		query.Set("scope", challenge.scope)
+	}
+	tokenURL.RawQuery = query.Encode()
+
+	if c.verbose {
+		fmt.Printf("Fetching a token from: %s\n", tokenURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("creating token request: %w", err)
+	}
+	c.addHeaders(req)
+	if creds, ok := c.credentialsFor(host); ok {
+		req.SetBasicAuth(creds.username, creds.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return "", fmt.Errorf("%w: failed to fetch token from %s: %s", ErrUnauthorized, challenge.realm, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch token from %s: %s", challenge.realm, resp.Status)
+	}
+
+	var tokenResponse struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxTokenResponseSize)).Decode(&tokenResponse); err != nil {
+		return "", fmt.Errorf("decoding token response: %w", err)
+	}
+	token = cmp.Or(tokenResponse.Token, tokenResponse.AccessToken)
+	if token == "" {
+		return "", fmt.Errorf("the token response from %s has no token", challenge.realm)
+	}
+
+	c.tokensMu.Lock()
+	if c.tokens == nil {
+		c.tokens = make(map[string]string)
+	}
+	c.tokens[challenge.tokenKey()] = token
+	c.tokensMu.Unlock()
+	return token, nil
+}
+
+// authorize handles a 401 response with a bearer challenge by fetching a token and sending
+// the request again with it. A basic challenge is answered with the credentials for the host,
+// if there are any and they were not just sent. Other responses are returned as they are.
+func (c *Client) authorize(req *http.Request, resp *http.Response) (*http.Response, error) {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	header := resp.Header.Get("Www-Authenticate")
+	challenge, ok := parseBearerChallenge(header)
+	if !ok {
+		return c.authorizeBasic(req, resp, header)
+	}
+	resp.Body.Close()
+	if strings.HasPrefix(req.Header.Get("Authorization"), "Bearer ") {
+		// The token that was sent has expired, so fetch a new one
+		c.tokensMu.Lock()
+		delete(c.tokens, challenge.tokenKey())
+		c.tokensMu.Unlock()
+	}
+	token, err := c.fetchToken(req.Context(), challenge, req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.scope != "" {
+		c.tokensMu.Lock()
+		c.tokens[scopeKey(req.URL.Host, challenge.scope)] = token
+		c.tokensMu.Unlock()
+	}
+	retry := req.Clone(req.Context())
+	retry.Header.Set("Authorization", "Bearer "+token)
+	return c.send(retry)
+}
+
+// authorizeBasic answers a basic challenge by sending the request again with the credentials for its
+// host. The host is remembered, so that later requests to it get the credentials right away.
+func (c *Client) authorizeBasic(req *http.Request, resp *http.Response, header string) (*http.Response, error) {
+	scheme, _, _ := strings.Cut(strings.TrimSpace(header), " ")
+	if !strings.EqualFold(scheme, "Basic") {
+		return resp, nil
+	}
+	creds, ok := c.credentialsFor(req.URL.Host)
+	if !ok {
+		return resp, nil
+	}
+	if _, _, sent := req.BasicAuth(); sent {
+		// The credentials were refused
+		return resp, nil
+	}
+	resp.Body.Close()
+	c.tokensMu.Lock()
+	if c.basicHosts == nil {
+		c.basicHosts = make(map[string]bool)
+	}
+	c.basicHosts[req.URL.Host] = true
+	c.tokensMu.Unlock()
+	retry := req.Clone(req.Context())
+	retry.SetBasicAuth(creds.username, creds.password)
+	return c.send(retry)
+}
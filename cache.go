@@ -0,0 +1,107 @@
+package ollamaurl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Cache stores raw manifests between runs. Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the cached value and true, or false if there is no usable entry
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, key string) error
+}
+
+// FileCache is a Cache that keeps one file per key in a directory.
+// Entries older than TTL are treated as missing, unless TTL is 0. Manifests that
+// are fetched by digest can not change, so those entries never expire.
+type FileCache struct {
+	Dir string
+	TTL time.Duration
+}
+
+// NewFileCache returns a FileCache that stores its entries in dir
+func NewFileCache(dir string, ttl time.Duration) *FileCache {
+	return &FileCache{Dir: dir, TTL: ttl}
+}
+
+// path returns the filename for a key. Keys are hashed, since they contain URLs.
+func (fc *FileCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(fc.Dir, hex.EncodeToString(sum[:]))
+}
+
+func (fc *FileCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	filename := fc.path(key)
+	info, err := os.Stat(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	if fc.TTL > 0 && !isImmutableKey(key) && time.Since(info.ModTime()) > fc.TTL {
+		return nil, false, nil
+	}
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (fc *FileCache) Set(ctx context.Context, key string, value []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(fc.Dir, 0755); err != nil {
+		return err
+	}
+	// Write to a temporary file first, so that readers never see a partial entry
+	f, err := os.CreateTemp(fc.Dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(value); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), fc.path(key))
+}
+
+func (fc *FileCache) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := os.Remove(fc.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// isImmutableKey reports if a cache key is for a manifest that is fetched by digest
+func isImmutableKey(key string) bool {
+	return strings.HasPrefix(key, "manifest ") && strings.Contains(key, "/manifests/sha256:")
+}
+
+// manifestCacheKey identifies a manifest by registry, repository and tag
+func manifestCacheKey(manifestURL string) string {
+	return "manifest " + manifestURL
+}
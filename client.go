@@ -0,0 +1,678 @@
+// Package ollamaurl finds the URLs of the blobs that make up a model in the Ollama registry,
+// or any other registry that speaks the OCI distribution API, and can download and verify them.
+package ollamaurl
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRegistry  = "https://registry.ollama.ai"
+	DefaultTag       = "latest"
+	DefaultNamespace = "library"
+	ManifestFilename = "manifest.json"
+
+	// MediaTypePrefix is the common prefix of the layer media types that Ollama uses
+	MediaTypePrefix = "application/vnd.ollama.image."
+)
+
+// Manifest media types, for the Accept header and for telling manifests and manifest lists apart
+const (
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+// DefaultAccept are the manifest media types that are asked for, unless SetAccept is used.
+// Manifest lists are followed to the manifest for the platform.
+var DefaultAccept = []string{MediaTypeDockerManifest, MediaTypeOCIManifest, MediaTypeDockerManifestList, MediaTypeOCIIndex}
+
+type Layer struct {
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	MediaType   string            `json:"mediaType"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type Manifest struct {
+	SchemaVersion int     `json:"schemaVersion"`
+	MediaType     string  `json:"mediaType"`
+	Config        Layer   `json:"config"`
+	Layers        []Layer `json:"layers"`
+
+	// Digest is the sha256 digest of the manifest as it was received
+	Digest string `json:"-"`
+
+	// Headers are the response headers, or nil if the manifest came from the cache
+	Headers http.Header `json:"-"`
+
+	// Raw is the manifest exactly as it was received
+	Raw []byte `json:"-"`
+
+	// Registry is the base URL of the registry or mirror that the manifest came from
+	Registry *url.URL `json:"-"`
+
+	// Platform is the platform that the manifest was picked for from a manifest list,
+	// or nil if the registry sent the manifest itself
+	Platform *Platform `json:"-"`
+}
+
+type Client struct {
+	base      *url.URL
+	mirrors   []*url.URL
+	http      *http.Client
+	rateLimit rateLimit
+	cache     Cache
+	verbose   bool
+
+	manifestRetries int
+	blobRetries     int
+
+	// accept are the media types in the Accept header of manifest requests
+	accept []string
+
+	// header is sent with every request
+	header http.Header
+
+	// platform is picked from manifest lists, the host platform if it is not set
+	platform Platform
+
+	// identityEncoding asks for blobs without transport compression
+	identityEncoding bool
+
+	verifier Verifier
+
+	// credentials are sent as basic auth, but only to the host they are for, and only once
+	// that host has asked for them with a 401 response. basicHosts are the hosts that have.
+	// They are also sent to the token endpoint of a bearer challenge from that host.
+	credentials map[string]credentials
+	basicHosts  map[string]bool
+
+	// tokens are bearer tokens from the token endpoint, by challenge and by host and scope.
+	// tokensMu also guards credentials and basicHosts.
+	tokens   map[string]string
+	tokensMu sync.Mutex
+
+	// served is the registry that served the manifest, by repository, so that blobs come from there too
+	served   map[string]*url.URL
+	servedMu sync.Mutex
+}
+
+func NewClient(base *url.URL, httpClient *http.Client) *Client {
+	return &Client{
+		base: base,
+		http: httpClient,
+	}
+}
+
+// BaseURL returns the registry URL that the client was created with
+func (c *Client) BaseURL() *url.URL {
+	return c.base
+}
+
+// SetMirrors gives registries to try in order when fetching a manifest from the base URL fails.
+// The blobs of a repository are then fetched from the registry that served its manifest.
+func (c *Client) SetMirrors(mirrors ...*url.URL) {
+	c.mirrors = mirrors
+}
+
+// registries returns the base URL followed by the mirrors
+func (c *Client) registries() []*url.URL {
+	return append([]*url.URL{c.base}, c.mirrors...)
+}
+
+// registryFor returns the registry that served the manifest for the repository,
+// or the base URL if no manifest has been fetched for it yet
+func (c *Client) registryFor(repository string) *url.URL {
+	c.servedMu.Lock()
+	defer c.servedMu.Unlock()
+	if base, ok := c.served[repository]; ok {
+		return base
+	}
+	return c.base
+}
+
+// SetVerbose makes the client print what it fetches and the rate limit status to stdout
+func (c *Client) SetVerbose(verbose bool) {
+	c.verbose = verbose
+}
+
+// SetIdentityEncoding makes the client ask for blobs with Accept-Encoding: identity
+func (c *Client) SetIdentityEncoding(identity bool) {
+	c.identityEncoding = identity
+}
+
+// SetHeader sets a header that is sent with every request, like User-Agent.
+// Calling it again for the same key replaces the value.
+func (c *Client) SetHeader(key, value string) {
+	if c.header == nil {
+		c.header = make(http.Header)
+	}
+	c.header.Set(key, value)
+}
+
+// SetAccept sets the media types that manifests are asked for with.
+// Without any, DefaultAccept is used.
+func (c *Client) SetAccept(mediaTypes ...string) {
+	c.accept = mediaTypes
+}
+
+// SetCache makes GetManifest look up manifests in the given cache before asking
+// the registry, and store the ones it fetches. A nil cache disables caching.
+func (c *Client) SetCache(cache Cache) {
+	c.cache = cache
+}
+
+// NewRequest creates a request with the headers that the client sends to the registry.
+// All requests go through here, so that --print-requests shows exactly what would be sent.
+func (c *Client) NewRequest(ctx context.Context, method, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.addHeaders(req)
+	return req, nil
+}
+
+// addHeaders adds the headers from SetHeader to a request
+func (c *Client) addHeaders(req *http.Request) {
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+}
+
+// NewManifestRequest is like NewRequest, but for manifests, with the Accept header set
+func (c *Client) NewManifestRequest(ctx context.Context, method, url string) (*http.Request, error) {
+	req, err := c.NewRequest(ctx, method, url)
+	if err == nil {
+		accept := c.accept
+		if len(accept) == 0 {
+			accept = DefaultAccept
+		}
+		req.Header.Set("Accept", strings.Join(accept, ", "))
+	}
+	return req, err
+}
+
+// ManifestRequest returns the request that GetManifest sends for a manifest, to the registry that served
+// the repository or else the base URL, with the Authorization header that the client knows to send so far.
+// Nothing is sent, which is what --print-requests needs.
+func (c *Client) ManifestRequest(ctx context.Context, repository, reference string) (*http.Request, error) {
+	req, err := c.NewManifestRequest(ctx, http.MethodGet, ConstructManifestURL(c.registryFor(repository), repository, reference))
+	if err != nil {
+		return nil, err
+	}
+	return c.withAuthorization(req), nil
+}
+
+// BlobRequest is like ManifestRequest, but for the request that GetBlob sends for a blob
+func (c *Client) BlobRequest(ctx context.Context, repository, digest string) (*http.Request, error) {
+	req, err := c.newBlobRequest(ctx, http.MethodGet, ConstructBlobURL(c.registryFor(repository), repository, digest))
+	if err != nil {
+		return nil, err
+	}
+	return c.withAuthorization(req), nil
+}
+
+// isManifestList reports if a media type is that of a manifest list or an image index
+func isManifestList(mediaType string) bool {
+	mediaType, _, _ = strings.Cut(mediaType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+	return mediaType == MediaTypeDockerManifestList || mediaType == MediaTypeOCIIndex
+}
+
+// newBlobRequest is like NewRequest, but for blobs.
+// Model weights do not compress, so it can be better to ask proxies not to try.
+func (c *Client) newBlobRequest(ctx context.Context, method, url string) (*http.Request, error) {
+	req, err := c.NewRequest(ctx, method, url)
+	if err == nil && c.identityEncoding {
+		req.Header.Set("Accept-Encoding", "identity")
+	}
+	return req, err
+}
+
+// do performs a request with a bearer token, if the registry has asked for one for this repository before,
+// or with basic auth if the host has asked for that. A challenge is answered by sending the request again.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	req = c.withAuthorization(req)
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.authorize(req, resp)
+}
+
+// send performs a request, and slows down first if the registry has reported that the rate limit is close
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	if d := c.rateLimit.delay(time.Now()); d > 0 {
+		if c.verbose {
+			fmt.Printf("Close to the registry rate limit, waiting %s\n", d.Round(time.Millisecond))
+		}
+		if err := sleepContext(req.Context(), d); err != nil {
+			return nil, fmt.Errorf("waiting for the rate limit to reset: %w", err)
+		}
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("performing HTTP request: %w", err)
+	}
+	c.rateLimit.update(resp.Header, time.Now())
+	if c.verbose {
+		if status, ok := c.rateLimit.status(time.Now()); ok {
+			fmt.Printf("Rate limit: %s\n", status)
+		}
+	}
+	return resp, nil
+}
+
+// ErrEmptyManifest is returned for a manifest without a config and without layers, which has no blobs to download
+var ErrEmptyManifest = errors.New("the manifest has no config and no layers, so there is nothing to download (it may be a manifest list or an image index of an unknown media type)")
+
+// GetManifest retrieves the model's manifest from the cache, if one is set, or from the registry.
+// The repository is the full path, like "library/tinyllama", and the reference is a tag or a digest.
+// If the registry fails, each mirror is tried in turn, and the errors are joined if all of them fail.
+func (c *Client) GetManifest(ctx context.Context, repository, reference string, verbose bool) (*Manifest, error) {
+	registries := c.registries()
+	var errs []error
+	for _, base := range registries {
+		manifest, err := c.getManifest(ctx, base, repository, reference, verbose)
+		if err != nil {
+			if len(registries) == 1 || ctx.Err() != nil {
+				return nil, err
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", base.Host, err))
+			continue
+		}
+		if verbose && len(registries) > 1 {
+			fmt.Printf("Using registry: %s\n", base)
+		}
+		manifest.Registry = base
+		c.servedMu.Lock()
+		if c.served == nil {
+			c.served = make(map[string]*url.URL)
+		}
+		c.served[repository] = base
+		c.servedMu.Unlock()
+		return manifest, nil
+	}
+	return nil, errors.Join(errs...)
+}
+
+// getManifest retrieves a manifest from the cache or from a single registry
+func (c *Client) getManifest(ctx context.Context, base *url.URL, repository, reference string, verbose bool) (*Manifest, error) {
+	manifestURL := ConstructManifestURL(base, repository, reference)
+
+	cacheKey := manifestCacheKey(manifestURL)
+	if c.cache != nil {
+		data, found, err := c.cache.Get(ctx, cacheKey)
+		if err != nil {
+			return nil, fmt.Errorf("reading manifest cache: %w", err)
+		}
+		if found {
+			var manifest Manifest
+			if err := json.Unmarshal(data, &manifest); err == nil {
+				if isManifestList(manifest.MediaType) {
+					if verbose {
+						fmt.Printf("Using cached manifest list for: %s\n", manifestURL)
+					}
+					return c.resolveManifestList(ctx, base, repository, data, verbose)
+				}
+				manifest.Digest = SHA256Digest(data)
+				manifest.Raw = data
+				if verbose {
+					fmt.Printf("Using cached manifest for: %s\n", manifestURL)
+				}
+				return &manifest, nil
+			}
+			// A broken entry is dropped and fetched again
+			if err := c.cache.Delete(ctx, cacheKey); err != nil {
+				return nil, fmt.Errorf("deleting manifest cache entry: %w", err)
+			}
+		}
+	}
+
+	if verbose {
+		fmt.Printf("Fetching manifest from: %s\n", manifestURL)
+	}
+
+	req, err := c.NewManifestRequest(ctx, http.MethodGet, manifestURL)
+	if err != nil {
+		return nil, fmt.Errorf("creating HTTP request: %w", err)
+	}
+	resp, err := c.doWithRetries(req, c.manifestRetries)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, c.notFoundError(ctx, base, repository, reference, resp)
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		if _, _, sent := resp.Request.BasicAuth(); sent {
+			return nil, fmt.Errorf("%w: %s refused the credentials: %s", ErrUnauthorized, base.Host, resp.Status)
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		if err := checkChallenge(resp); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to fetch manifest: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	if isChallenge(resp, data) {
+		return nil, ErrAntiBotChallenge
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("decoding manifest JSON: %w", err)
+	}
+	manifest.Digest = SHA256Digest(data)
+	manifest.Headers = resp.Header
+	manifest.Raw = data
+
+	// A manifest that is fetched by digest must be exactly that manifest
+	if strings.HasPrefix(reference, "sha256:") && manifest.Digest != reference {
+		return nil, fmt.Errorf("%w: asked for manifest %s, got %s", ErrDigestMismatch, reference, manifest.Digest)
+	}
+
+	// Some registries only say that it is a manifest list in the Content-Type header
+	isList := isManifestList(cmp.Or(manifest.MediaType, resp.Header.Get("Content-Type")))
+
+	// A 200 with something that is not a manifest would otherwise look like a model without blobs
+	if !isList && manifest.Config.Digest == "" && len(manifest.Layers) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrEmptyManifest, manifestURL)
+	}
+
+	if c.cache != nil {
+		if err := c.cache.Set(ctx, cacheKey, data); err != nil {
+			return nil, fmt.Errorf("writing manifest cache: %w", err)
+		}
+	}
+
+	if isList {
+		return c.resolveManifestList(ctx, base, repository, data, verbose)
+	}
+
+	return &manifest, nil
+}
+
+// ErrNoDigestHeader is returned by ManifestDigest when the registry does not say which digest a manifest has
+var ErrNoDigestHeader = errors.New("the registry did not send a Docker-Content-Digest header")
+
+// ManifestDigest asks the registry which manifest a tag points to right now, and returns the digest
+// from the Docker-Content-Digest response header. It sends a HEAD request, or a GET request to
+// registries that do not support HEAD for manifests, and never uses the cache. For a manifest list,
+// it is the digest of the list. Mirrors are tried in turn, like for GetManifest.
+func (c *Client) ManifestDigest(ctx context.Context, repository, reference string) (string, error) {
+	registries := c.registries()
+	var errs []error
+	for _, base := range registries {
+		digest, err := c.manifestDigest(ctx, base, repository, reference)
+		if err != nil {
+			if len(registries) == 1 || ctx.Err() != nil {
+				return "", err
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", base.Host, err))
+			continue
+		}
+		return digest, nil
+	}
+	return "", errors.Join(errs...)
+}
+
+// manifestDigest asks a single registry for the digest of a manifest
+func (c *Client) manifestDigest(ctx context.Context, base *url.URL, repository, reference string) (string, error) {
+	manifestURL := ConstructManifestURL(base, repository, reference)
+	if c.verbose {
+		fmt.Printf("Asking for the manifest digest at: %s\n", manifestURL)
+	}
+	var resp *http.Response
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := c.NewManifestRequest(ctx, method, manifestURL)
+		if err != nil {
+			return "", fmt.Errorf("creating HTTP request: %w", err)
+		}
+		if resp, err = c.doWithRetries(req, c.manifestRetries); err != nil {
+			return "", err
+		}
+		if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented {
+			break
+		}
+		resp.Body.Close()
+	}
+	// Only the headers are needed, and the body of an error
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", c.notFoundError(ctx, base, repository, reference, resp)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch manifest digest: %s", resp.Status)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("%w for %s", ErrNoDigestHeader, manifestURL)
+	}
+	if err := ValidateDigest(digest); err != nil {
+		return "", fmt.Errorf("invalid Docker-Content-Digest header: %w", err)
+	}
+	return digest, nil
+}
+
+// GetBlob opens a stream for the blob with the given digest. The caller must close it.
+func (c *Client) GetBlob(ctx context.Context, repository, digest string) (io.ReadCloser, error) {
+	req, err := c.newBlobRequest(ctx, http.MethodGet, ConstructBlobURL(c.registryFor(repository), repository, digest))
+	if err != nil {
+		return nil, fmt.Errorf("creating HTTP request: %w", err)
+	}
+	resp, err := c.doWithRetries(req, c.blobRetries)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		if err := checkChallenge(resp); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to fetch blob %s: %s", digest, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// GetBlobFrom is like GetBlob, but asks for the blob from the given offset with a Range request,
+// to resume a download. It returns the offset that the stream starts at, which is 0 if the
+// registry ignored the range and sent the whole blob.
+func (c *Client) GetBlobFrom(ctx context.Context, repository, digest string, offset int64) (io.ReadCloser, int64, error) {
+	req, err := c.newBlobRequest(ctx, http.MethodGet, ConstructBlobURL(c.registryFor(repository), repository, digest))
+	if err != nil {
+		return nil, 0, fmt.Errorf("creating HTTP request: %w", err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := c.doWithRetries(req, c.blobRetries)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, 0, nil
+	case http.StatusPartialContent:
+		var start int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-", &start); err != nil || start != offset {
+			resp.Body.Close()
+			return nil, 0, fmt.Errorf("the registry sent blob %s from %q, but it was asked for from byte %d", digest, resp.Header.Get("Content-Range"), offset)
+		}
+		return resp.Body, offset, nil
+	}
+	defer resp.Body.Close()
+	if err := checkChallenge(resp); err != nil {
+		return nil, 0, err
+	}
+	return nil, 0, fmt.Errorf("failed to fetch blob %s: %s", digest, resp.Status)
+}
+
+// ErrHeadNotSupported is returned for HEAD requests that the registry does not support
+var ErrHeadNotSupported = errors.New("the registry does not support HEAD requests for blobs")
+
+// HeadBlob asks the registry for the size of a blob without downloading it.
+// The returned size is -1 if the registry did not send a Content-Length.
+func (c *Client) HeadBlob(ctx context.Context, repository, digest string) (int64, error) {
+	resp, err := c.headBlob(ctx, repository, digest)
+	if err != nil {
+		return 0, err
+	}
+	return resp.ContentLength, nil
+}
+
+// headBlob sends a HEAD request for a blob and returns the response, which has no body
+func (c *Client) headBlob(ctx context.Context, repository, digest string) (*http.Response, error) {
+	req, err := c.newBlobRequest(ctx, http.MethodHead, ConstructBlobURL(c.registryFor(repository), repository, digest))
+	if err != nil {
+		return nil, fmt.Errorf("creating HTTP request: %w", err)
+	}
+	resp, err := c.doWithRetries(req, c.blobRetries)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented {
+		return nil, fmt.Errorf("%w: %s", ErrHeadNotSupported, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch blob size for %s: %s", digest, resp.Status)
+	}
+	return resp, nil
+}
+
+// BlobHeaders sends a HEAD request for a blob and returns the response headers
+func (c *Client) BlobHeaders(ctx context.Context, repository, digest string) (http.Header, error) {
+	resp, err := c.headBlob(ctx, repository, digest)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Header, nil
+}
+
+// SelectLayer finds a single layer, either by its index in the manifest layers or by its digest.
+// The config layer can only be selected by digest.
+func SelectLayer(manifest *Manifest, selector string) (Layer, error) {
+	if i, err := strconv.Atoi(selector); err == nil {
+		if i < 0 || i >= len(manifest.Layers) {
+			return Layer{}, fmt.Errorf("layer index %d is out of range, the manifest has %d layers", i, len(manifest.Layers))
+		}
+		return manifest.Layers[i], nil
+	}
+	// Also accept the filename form of the digest, with '-' instead of ':'
+	digest := strings.Replace(selector, "-", ":", 1)
+	if manifest.Config.Digest != "" && manifest.Config.Digest == digest {
+		return manifest.Config, nil
+	}
+	for _, layer := range manifest.Layers {
+		if layer.Digest == digest {
+			return layer, nil
+		}
+	}
+	return Layer{}, fmt.Errorf("no layer with digest %s", selector)
+}
+
+// DownloadBlob streams a blob from the registry to w and returns the number of bytes written.
+// The received bytes are checked with VerifyBlob, which for a Client uses its Verifier, sha256 by default,
+// and an error is returned if they do not match. Since the data is streamed, w has then
+// already received all of it.
+func DownloadBlob(ctx context.Context, registry Registry, repository, digest string, w io.Writer) (int64, error) {
+	body, err := registry.GetBlob(ctx, repository, digest)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	// The verifier reads a copy of the data while it is being written to w
+	pr, pw := io.Pipe()
+	verified := make(chan error, 1)
+	go func() {
+		err := registry.VerifyBlob(digest, pr)
+		// Stop the download if the verifier gave up early, and let it finish if not
+		pr.CloseWithError(err)
+		verified <- err
+	}()
+
+	n, err := io.Copy(w, io.TeeReader(body, pw))
+	if err != nil {
+		err = fmt.Errorf("streaming blob %s: %w", digest, err)
+	}
+	pw.CloseWithError(err)
+	if verifyErr := <-verified; verifyErr != nil {
+		return n, verifyErr
+	}
+	return n, err
+}
+
+// resolveRegistryPath resolves a path against the registry base URL.
+// ResolveReference drops the query of the base URL, so it is copied over, since some
+// registries backed by object stores use query parameters for authentication.
+func resolveRegistryPath(base *url.URL, elem ...string) string {
+	resolved := base.ResolveReference(&url.URL{
+		Path: path.Join(elem...),
+	})
+	resolved.RawQuery = base.RawQuery
+	return resolved.String()
+}
+
+// ConstructManifestURL generates the URL for fetching a manifest by tag or digest
+func ConstructManifestURL(base *url.URL, repository string, reference string) string {
+	return resolveRegistryPath(base, "v2", repository, "manifests", reference)
+}
+
+// ConstructBlobURL generates the URL for downloading a blob
+func ConstructBlobURL(base *url.URL, repository string, digest string) string {
+	return resolveRegistryPath(base, "v2", repository, "blobs", digest)
+}
+
+// SHA256Digest returns the digest of data, like sha256:<hex>
+func SHA256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// CreateFilename creates a filename from the digest by replacing ':' with '-'
+func CreateFilename(digest string) string {
+	return strings.ReplaceAll(digest, ":", "-")
+}
+
+// SetBasicAuth is SetCredentials for the host of the base URL. Mirrors do not get these credentials.
+func (c *Client) SetBasicAuth(username, password string) {
+	c.SetCredentials(c.base.Host, username, password)
+}
+
+// SetCredentials gives the credentials for a registry host, like "registry.example.com" or "localhost:5000".
+// They are only sent to that host, as basic auth when it answers with a 401 response, and to the
+// token endpoint when it asks for a bearer token.
+func (c *Client) SetCredentials(host, username, password string) {
+	c.tokensMu.Lock()
+	defer c.tokensMu.Unlock()
+	if c.credentials == nil {
+		c.credentials = make(map[string]credentials)
+	}
+	c.credentials[host] = credentials{username, password}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+// fetchManifest parses the model name and retrieves its manifest
+func fetchManifest(ctx context.Context, client ollamaurl.Registry, modelName string, opts options) (ollamaurl.ModelRef, *ollamaurl.Manifest, error) {
+	// Parse the model name into namespace, repository and tag
+	ref, err := ollamaurl.ParseModelPath(modelName, opts.defaults)
+	if err != nil {
+		return ollamaurl.ModelRef{}, nil, fmt.Errorf("parsing model name: %w", err)
+	}
+	if opts.printRef {
+		printRef(modelName, ref)
+	}
+
+	manifest, err := client.GetManifest(ctx, ref.Path(), ref.Reference(), opts.verbose)
+	if errors.Is(err, ollamaurl.ErrModelNotFound) && ref.Digest == "" {
+		return ollamaurl.ModelRef{}, nil, fmt.Errorf("retrieving manifest: %w (--list-tags lists the tags of %s)", err, ref.Path())
+	}
+	if err != nil {
+		return ollamaurl.ModelRef{}, nil, fmt.Errorf("retrieving manifest: %w", err)
+	}
+
+	if opts.expectDigest != "" && manifest.Digest != opts.expectDigest {
+		return ollamaurl.ModelRef{}, nil, fmt.Errorf("the manifest digest is %s, but %s was expected", manifest.Digest, opts.expectDigest)
+	}
+
+	if opts.expectLayers >= 0 && len(manifest.Layers) != opts.expectLayers {
+		return ollamaurl.ModelRef{}, nil, fmt.Errorf("the manifest has %d layers, but %d were expected", len(manifest.Layers), opts.expectLayers)
+	}
+
+	if opts.strictMediaTypes {
+		if err := checkMediaTypes(manifest); err != nil {
+			return ollamaurl.ModelRef{}, nil, err
+		}
+	}
+
+	if opts.verifyKey != nil {
+		if err := client.VerifyManifestSignature(ctx, ref.Path(), manifest.Digest, opts.verifyKey); err != nil {
+			return ollamaurl.ModelRef{}, nil, err
+		}
+	}
+
+	if opts.ignoreConfig {
+		if opts.verbose && manifest.Config.Digest != "" {
+			fmt.Printf("Ignoring config layer: digest = %s\n", manifest.Config.Digest)
+		}
+		manifest.Config = ollamaurl.Layer{}
+	}
+
+	filterLayers(manifest, opts.annotations, opts.verbose)
+	filterMediaTypes(manifest, opts.mediaTypes, opts.verbose)
+
+	if opts.total != nil {
+		opts.total.add(manifest)
+	}
+
+	return ref, manifest, nil
+}
+
+// fetchPlan retrieves the manifest for a model and turns it into a plan
+func fetchPlan(ctx context.Context, client ollamaurl.Registry, modelName string, opts options) (*ollamaurl.Plan, error) {
+	ref, manifest, err := fetchManifest(ctx, client, modelName, opts)
+	if err != nil {
+		return nil, err
+	}
+	plan := ollamaurl.NewPlan(manifest.Registry, modelName, ref, manifest, opts.verbose)
+	if opts.filenameTemplate != nil {
+		if err := applyFilenameTemplate(plan, opts.filenameTemplate); err != nil {
+			return nil, err
+		}
+	}
+	if opts.includeHeaders {
+		if err := addResponseHeaders(ctx, client, plan, manifest); err != nil {
+			return nil, err
+		}
+	}
+	if opts.relativeURLs {
+		plan.RelativeTo(manifest.Registry)
+	}
+	return plan, nil
+}
+
+// fetchPlans fetches the plans for several models at the same time.
+// The plans and errors are in the same order as the model names.
+// A fatal error for one model stops the others, which then fail with that error as the cause.
+func fetchPlans(ctx context.Context, client ollamaurl.Registry, modelNames []string, opts options) ([]*ollamaurl.Plan, []error) {
+	plans := make([]*ollamaurl.Plan, len(modelNames))
+	errs := make([]error, len(modelNames))
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+	waitModels(startModels(ctx, modelNames, opts.modelConcurrency(), func(ctx context.Context, i int) {
+		if ctx.Err() != nil {
+			errs[i] = context.Cause(ctx)
+			return
+		}
+		modelCtx, cancel := opts.modelContext(ctx)
+		defer cancel()
+		plans[i], errs[i] = fetchPlan(modelCtx, client, modelNames[i], opts)
+		stopOnFatal(stop, modelNames[i], errs[i])
+	}))
+	return plans, errs
+}
+
+// BatchError is a model that could not be processed in a batch run
+type BatchError struct {
+	Model string `json:"model"`
+	Error string `json:"error"`
+}
+
+// BatchResult holds the plans for all models of a batch run, and the errors for the ones that failed
+type BatchResult struct {
+	Models []*ollamaurl.Plan `json:"models"`
+	Total  *GrandTotal       `json:"total,omitempty"`
+	Errors []BatchError      `json:"errors"`
+}
+
+// writeBatchJSON fetches the plan for every model and writes them as a single JSON object.
+// A failing model does not stop the others. Returns false if any model failed.
+func writeBatchJSON(ctx context.Context, w io.Writer, client ollamaurl.Registry, modelNames []string, opts options) bool {
+	result := BatchResult{
+		Models: []*ollamaurl.Plan{},
+		Errors: []BatchError{},
+	}
+	plans, errs := fetchPlans(ctx, client, modelNames, opts)
+	for i, modelName := range modelNames {
+		if errs[i] != nil {
+			result.Errors = append(result.Errors, BatchError{Model: modelName, Error: errs[i].Error()})
+			continue
+		}
+		result.Models = append(result.Models, plans[i])
+	}
+	result.Total = opts.total
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+		return false
+	}
+	return len(result.Errors) == 0
+}
+
+// writeJSONByModel fetches the plan for every model and writes them as one JSON object keyed by
+// model name, which is what --json writes for several models. The keys are in the order the models
+// were given, and each name may only be given once. Failing models are reported on stderr and left
+// out. Returns false if any model failed.
+func writeJSONByModel(ctx context.Context, w io.Writer, client ollamaurl.Registry, modelNames []string, opts options) bool {
+	if name, found := duplicateModelName(modelNames); found {
+		fmt.Fprintf(os.Stderr, "Error: %s is given more than once, but each model is a key of the JSON object\n", name)
+		return false
+	}
+	ok := true
+	plans, errs := fetchPlans(ctx, client, modelNames, opts)
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	first := true
+	for i, modelName := range modelNames {
+		if errs[i] != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", modelName, errs[i])
+			ok = false
+			continue
+		}
+		key, err := json.Marshal(modelName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+			return false
+		}
+		value, err := json.MarshalIndent(plans[i], "  ", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+			return false
+		}
+		if !first {
+			buf.WriteString(",")
+		}
+		first = false
+		fmt.Fprintf(&buf, "\n  %s: %s", key, value)
+	}
+	if !first {
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}\n")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+		return false
+	}
+	return ok
+}
+
+// duplicateModelName returns the first model name that is given more than once, if any
+func duplicateModelName(modelNames []string) (string, bool) {
+	seen := make(map[string]bool, len(modelNames))
+	for _, modelName := range modelNames {
+		if seen[modelName] {
+			return modelName, true
+		}
+		seen[modelName] = true
+	}
+	return "", false
+}
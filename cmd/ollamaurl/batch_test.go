@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+// testOptions are the options that a run without any flags would have
+func testOptions() options {
+	return options{
+		defaults:     ollamaurl.ModelDefaults{Namespace: ollamaurl.DefaultNamespace, Tag: ollamaurl.DefaultTag},
+		expectLayers: -1,
+		concurrency:  1,
+	}
+}
+
+func TestFetchPlan(t *testing.T) {
+	const blobs = "https://registry.test/v2/library/tinyllama/blobs/"
+	tests := []struct {
+		name  string
+		model string
+		opts  func(*options)
+		want  []string // the URL of every blob, the manifest last
+	}{
+		{"every blob", "tinyllama", nil, []string{
+			blobs + testDigest("c"),
+			blobs + testDigest("1"),
+			blobs + testDigest("2"),
+			blobs + testDigest("3"),
+			"https://registry.test/v2/library/tinyllama/manifests/latest",
+		}},
+		{"pinned", "tinyllama@" + testDigest("f"), nil, []string{
+			blobs + testDigest("c"),
+			blobs + testDigest("1"),
+			blobs + testDigest("2"),
+			blobs + testDigest("3"),
+			"https://registry.test/v2/library/tinyllama/manifests/" + testDigest("f"),
+		}},
+		{"ignore config", "tinyllama", func(o *options) { o.ignoreConfig = true }, []string{
+			blobs + testDigest("1"),
+			blobs + testDigest("2"),
+			blobs + testDigest("3"),
+			"https://registry.test/v2/library/tinyllama/manifests/latest",
+		}},
+		{"media type", "tinyllama", func(o *options) { o.mediaTypes = []string{ollamaurl.ModelMediaType} }, []string{
+			blobs + testDigest("c"),
+			blobs + testDigest("1"),
+			"https://registry.test/v2/library/tinyllama/manifests/latest",
+		}},
+		{"annotation", "tinyllama", func(o *options) { o.annotations = []annotationSelector{{key: "role", value: "legal", hasValue: true}} }, []string{
+			blobs + testDigest("c"),
+			blobs + testDigest("3"),
+			"https://registry.test/v2/library/tinyllama/manifests/latest",
+		}},
+		{"relative", "tinyllama", func(o *options) { o.relativeURLs, o.ignoreConfig = true, true }, []string{
+			"/v2/library/tinyllama/blobs/" + testDigest("1"),
+			"/v2/library/tinyllama/blobs/" + testDigest("2"),
+			"/v2/library/tinyllama/blobs/" + testDigest("3"),
+			"/v2/library/tinyllama/manifests/latest",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOptions()
+			if tt.opts != nil {
+				tt.opts(&opts)
+			}
+			plan, err := fetchPlan(context.Background(), newFakeRegistry(), tt.model, opts)
+			if err != nil {
+				t.Fatalf("fetchPlan(%q): %v", tt.model, err)
+			}
+			var got []string
+			for _, blob := range plan.Blobs {
+				got = append(got, blob.URL)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d blobs, want %d:\n%q", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("blob %d: got %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+			if last := plan.Blobs[len(plan.Blobs)-1]; !last.IsManifest() {
+				t.Errorf("the last blob is %s, not the manifest", last.Filename)
+			}
+		})
+	}
+}
+
+func TestFetchPlanTotals(t *testing.T) {
+	plan, err := fetchPlan(context.Background(), newFakeRegistry(), "tinyllama", testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.TotalSize != 1060 || plan.Layers != 3 || plan.LargestLayer != testDigest("1") || plan.SizeIncomplete {
+		t.Errorf("got a total of %d bytes in %d layers, the largest %s, incomplete %v", plan.TotalSize, plan.Layers, plan.LargestLayer, plan.SizeIncomplete)
+	}
+	if manifest := plan.Blobs[len(plan.Blobs)-1]; manifest.Filename != ollamaurl.ManifestFilename || manifest.Digest != "" {
+		t.Errorf("the manifest of a tag is %s with digest %q, want %s without a digest", manifest.Filename, manifest.Digest, ollamaurl.ManifestFilename)
+	}
+
+	pinned, err := fetchPlan(context.Background(), newFakeRegistry(), "tinyllama@"+testDigest("f"), testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest := pinned.Blobs[len(pinned.Blobs)-1]; manifest.Filename != ollamaurl.CreateFilename(testDigest("f")) || manifest.Digest != testDigest("f") {
+		t.Errorf("the manifest of a pinned model is %s with digest %q", manifest.Filename, manifest.Digest)
+	}
+}
+
+func TestFetchPlanErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		model string
+		opts  func(*options)
+		is    error // nil if any error will do
+	}{
+		{"unknown model", "other", nil, ollamaurl.ErrModelNotFound},
+		{"unknown tag", "tinyllama:1.1b", nil, ollamaurl.ErrModelNotFound},
+		{"invalid name", "Tiny Llama", nil, nil},
+		{"expect digest", "tinyllama", func(o *options) { o.expectDigest = testDigest("0") }, nil},
+		{"expect layers", "tinyllama", func(o *options) { o.expectLayers = 2 }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOptions()
+			if tt.opts != nil {
+				tt.opts(&opts)
+			}
+			_, err := fetchPlan(context.Background(), newFakeRegistry(), tt.model, opts)
+			if err == nil {
+				t.Fatalf("fetchPlan(%q) did not fail", tt.model)
+			}
+			if tt.is != nil && !errors.Is(err, tt.is) {
+				t.Errorf("got %v, want %v", err, tt.is)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	shellBash = "bash"
+	shellZsh  = "zsh"
+	shellFish = "fish"
+)
+
+// completionShells are the shells that --completion can write a script for
+var completionShells = []string{shellBash, shellZsh, shellFish}
+
+// completionValues are the values that are offered for flags that only accept a few
+var completionValues = map[string][]string{
+	"format":             outputFormats,
+	"progress":           progressStyles,
+	"checksum-format":    checksumFormats,
+	"script-tool":        scriptTools,
+	"count-by-mediatype": {"text", "json"},
+	"min-tls-version":    slices.Sorted(maps.Keys(tlsVersions)),
+}
+
+// completionFiles are the flags that take a filename, and completionDirs the ones that take a directory
+var (
+	completionFiles = []string{"pkgbuild", "client-cert", "client-key", "verify-key", "from-file", "out"}
+	completionDirs  = []string{"output-dir", "verify", "prune", "metadata"}
+)
+
+// completionFlag is a flag as the completion scripts see it
+type completionFlag struct {
+	name      string
+	shorthand string
+	usage     string
+	hasValue  bool // the flag takes a value, either as the next word or after '='
+	optional  bool // the value can only be given after '=', like --count-by-mediatype=json
+	values    []string
+	files     bool
+	dirs      bool
+}
+
+// completionFlags returns the flags that are not hidden, sorted by name
+func completionFlags(flags *pflag.FlagSet) []completionFlag {
+	var result []completionFlag
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if flag.Hidden {
+			return
+		}
+		usage, _, _ := strings.Cut(flag.Usage, "\n")
+		result = append(result, completionFlag{
+			name:      flag.Name,
+			shorthand: flag.Shorthand,
+			usage:     usage,
+			hasValue:  flag.Value.Type() != "bool",
+			optional:  flag.Value.Type() != "bool" && flag.NoOptDefVal != "",
+			values:    completionValues[flag.Name],
+			files:     slices.Contains(completionFiles, flag.Name),
+			dirs:      slices.Contains(completionDirs, flag.Name),
+		})
+	})
+	return result
+}
+
+// writeCompletion writes a completion script for the flags to w, for bash, zsh or fish.
+// Model names are not completed, only the flags, their values and the config subcommand.
+func writeCompletion(w io.Writer, flags *pflag.FlagSet, shell string) error {
+	switch shell {
+	case shellBash:
+		return writeBashCompletion(w, completionFlags(flags))
+	case shellZsh:
+		return writeZshCompletion(w, completionFlags(flags))
+	case shellFish:
+		return writeFishCompletion(w, completionFlags(flags))
+	}
+	return fmt.Errorf("unknown --completion shell '%s', use one of: %s", shell, strings.Join(completionShells, ", "))
+}
+
+// writeBashCompletion writes a function for "complete -F". Values can follow a flag as the next
+// word or after '=', which bash splits into a word of its own.
+func writeBashCompletion(w io.Writer, flags []completionFlag) error {
+	var sb strings.Builder
+	sb.WriteString("# bash completion for ollamaurl, load it with: source <(ollamaurl --completion bash)\n")
+	sb.WriteString("_ollamaurl() {\n")
+	sb.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\" eq=\n")
+	sb.WriteString("    if [[ $cur == = ]]; then\n")
+	sb.WriteString("        cur= eq=1\n")
+	sb.WriteString("    elif [[ $prev == = ]]; then\n")
+	sb.WriteString("        prev=\"${COMP_WORDS[COMP_CWORD-2]}\" eq=1\n")
+	sb.WriteString("    fi\n")
+	sb.WriteString("    case $prev in\n")
+	var words []string
+	for _, flag := range flags {
+		words = append(words, "--"+flag.name)
+		if flag.shorthand != "" {
+			words = append(words, "-"+flag.shorthand)
+		}
+		if !flag.hasValue {
+			continue
+		}
+		var reply string
+		switch {
+		case flag.values != nil:
+			reply = fmt.Sprintf("COMPREPLY=($(compgen -W %q -- \"$cur\"))", strings.Join(flag.values, " "))
+		case flag.dirs:
+			reply = "COMPREPLY=($(compgen -d -- \"$cur\"))"
+		case flag.files:
+			reply = "COMPREPLY=($(compgen -f -- \"$cur\"))"
+		default:
+			reply = "COMPREPLY=()"
+		}
+		pattern := "--" + flag.name
+		if flag.shorthand != "" {
+			pattern += "|-" + flag.shorthand
+		}
+		if flag.optional {
+			fmt.Fprintf(&sb, "    %s)\n        if [[ -n $eq ]]; then\n            %s\n            return\n        fi\n        ;;\n", pattern, reply)
+		} else {
+			fmt.Fprintf(&sb, "    %s)\n        %s\n        return\n        ;;\n", pattern, reply)
+		}
+	}
+	sb.WriteString("    esac\n")
+	sb.WriteString("    if [[ $cur == -* ]]; then\n")
+	fmt.Fprintf(&sb, "        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(words, " "))
+	sb.WriteString("    else\n")
+	sb.WriteString("        COMPREPLY=($(compgen -W \"config\" -- \"$cur\"))\n")
+	sb.WriteString("    fi\n")
+	sb.WriteString("}\n")
+	sb.WriteString("complete -F _ollamaurl ollamaurl\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeZshCompletion writes a completion function that uses _arguments
+func writeZshCompletion(w io.Writer, flags []completionFlag) error {
+	var sb strings.Builder
+	sb.WriteString("#compdef ollamaurl\n")
+	sb.WriteString("# zsh completion for ollamaurl, save it as _ollamaurl in a directory in $fpath,\n")
+	sb.WriteString("# or load it with: source <(ollamaurl --completion zsh)\n")
+	sb.WriteString("_ollamaurl() {\n")
+	sb.WriteString("    _arguments -s -S \\\n")
+	for _, flag := range flags {
+		var action string
+		if flag.hasValue {
+			switch {
+			case flag.values != nil:
+				action = ":" + flag.name + ":(" + strings.Join(flag.values, " ") + ")"
+			case flag.dirs:
+				action = ":directory:_files -/"
+			case flag.files:
+				action = ":file:_files"
+			default:
+				action = ":" + flag.name + ": "
+			}
+		}
+		long := "--" + flag.name
+		switch {
+		case flag.optional:
+			long += "=-"
+			action = ":" + action
+		case flag.hasValue:
+			long += "="
+		}
+		desc := strings.NewReplacer(`[`, `\[`, `]`, `\]`).Replace(flag.usage)
+		spec := func(name string) string {
+			return "'" + strings.ReplaceAll(name+"["+desc+"]"+action, "'", `'\''`) + "'"
+		}
+		if flag.shorthand != "" {
+			fmt.Fprintf(&sb, "        '(-%s --%s)'%s \\\n", flag.shorthand, flag.name, spec("-"+flag.shorthand))
+			fmt.Fprintf(&sb, "        '(-%s --%s)'%s \\\n", flag.shorthand, flag.name, spec(long))
+		} else {
+			fmt.Fprintf(&sb, "        %s \\\n", spec(long))
+		}
+	}
+	sb.WriteString("        '*:model or subcommand:(config)'\n")
+	sb.WriteString("}\n")
+	sb.WriteString("if [[ $funcstack[1] == _ollamaurl ]]; then\n")
+	sb.WriteString("    _ollamaurl \"$@\"\n")
+	sb.WriteString("else\n")
+	sb.WriteString("    compdef _ollamaurl ollamaurl\n")
+	sb.WriteString("fi\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// fishQuote quotes s for a single quoted fish string
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// writeFishCompletion writes a "complete" command per flag. Fish has no flags with a value that
+// can only be given after '=', so those are completed like flags without a value.
+func writeFishCompletion(w io.Writer, flags []completionFlag) error {
+	var sb strings.Builder
+	sb.WriteString("# fish completion for ollamaurl, save it as ~/.config/fish/completions/ollamaurl.fish,\n")
+	sb.WriteString("# or load it with: ollamaurl --completion fish | source\n")
+	sb.WriteString("complete -c ollamaurl -f\n")
+	sb.WriteString("complete -c ollamaurl -n 'test (count (commandline -opc)) -eq 1' -a config -d 'Show the settings in effect and where they came from'\n")
+	for _, flag := range flags {
+		sb.WriteString("complete -c ollamaurl -l " + flag.name)
+		if flag.shorthand != "" {
+			sb.WriteString(" -s " + flag.shorthand)
+		}
+		sb.WriteString(" -d " + fishQuote(flag.usage))
+		if flag.hasValue && !flag.optional {
+			switch {
+			case flag.values != nil:
+				sb.WriteString(" -x -a " + fishQuote(strings.Join(flag.values, " ")))
+			case flag.dirs:
+				sb.WriteString(" -x -a '(__fish_complete_directories)'")
+			case flag.files:
+				sb.WriteString(" -r -F")
+			default:
+				sb.WriteString(" -x")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
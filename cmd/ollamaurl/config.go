@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+)
+
+// configPath returns the path to the configuration file, which is
+// $XDG_CONFIG_HOME/ollamaurl/config or ~/.config/ollamaurl/config
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ollamaurl", "config"), nil
+}
+
+// manifestCacheDir returns the directory for cached manifests, under $XDG_CACHE_HOME or ~/.cache
+func manifestCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ollamaurl", "manifests"), nil
+}
+
+// loadConfig reads "key = value" lines from the configuration file, where each key is the long
+// name of a flag, and applies them to the flags that were not given on the command line.
+// Empty lines and lines starting with '#' are ignored. A missing file is not an error.
+// The returned set has the names of the flags that got their value from the file.
+func loadConfig(flags *pflag.FlagSet, path string) (map[string]bool, error) {
+	fromFile := make(map[string]bool)
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fromFile, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, lineNumber)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		flag := flags.Lookup(key)
+		if flag == nil {
+			return nil, fmt.Errorf("%s:%d: unknown key %q", path, lineNumber, key)
+		}
+		if flag.Changed {
+			// Flags given on the command line take precedence
+			continue
+		}
+		if err := flag.Value.Set(value); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid value for %s: %w", path, lineNumber, key, err)
+		}
+		fromFile[key] = true
+	}
+	return fromFile, scanner.Err()
+}
+
+// configSettings are the settings shown by "ollamaurl config", by long flag name
+var configSettings = []string{
+	"registry",
+	"default-namespace",
+	"library-namespace",
+	"default-tag",
+	"concurrency",
+	"timeout",
+	"connect-timeout",
+	"header-timeout",
+	"deadline",
+	"cache-ttl",
+	"retries",
+	"manifest-retries",
+	"blob-retries",
+	"min-tls-version",
+	"client-cert",
+	"client-key",
+	"username",
+	"password",
+}
+
+// secretSettings are only shown as set or not set
+var secretSettings = map[string]bool{
+	"client-key": true,
+	"password":   true,
+}
+
+// settingEnvVars are the environment variables that are used when a setting is not given
+var settingEnvVars = map[string]string{
+	"registry": registryEnvVar,
+	"username": usernameEnvVar,
+	"password": passwordEnvVar,
+}
+
+// writeEffectiveConfig writes the value of each setting and where it came from:
+// the command line, the environment, the configuration file or the built-in default
+func writeEffectiveConfig(w io.Writer, flags *pflag.FlagSet, fromFile map[string]bool, path string) {
+	if path != "" {
+		if _, err := os.Stat(path); err == nil {
+			fmt.Fprintf(w, "# configuration file: %s\n", path)
+		} else {
+			fmt.Fprintf(w, "# configuration file: %s (not found)\n", path)
+		}
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, name := range configSettings {
+		flag := flags.Lookup(name)
+		if flag == nil {
+			continue
+		}
+		value, source := flag.Value.String(), "default"
+		switch {
+		case flag.Changed:
+			source = "flag"
+		case fromFile[name]:
+			source = "file"
+		case name == "default-namespace":
+			if value = resolveDefaultNamespace("", flags.Lookup("library-namespace").Value.String()); os.Getenv(namespaceEnvVar) != "" {
+				source = "env " + namespaceEnvVar
+			}
+		case name == "manifest-retries" || name == "blob-retries":
+			if retries := flags.Lookup("retries"); retries.Changed || fromFile["retries"] {
+				value, source = retries.Value.String(), "retries"
+			}
+		case os.Getenv(settingEnvVars[name]) != "":
+			value, source = os.Getenv(settingEnvVars[name]), "env "+settingEnvVars[name]
+		}
+		if secretSettings[name] {
+			if value != "" {
+				value = "(set)"
+			} else {
+				value = "(not set)"
+			}
+		} else if value == "" {
+			value = `""`
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", name, value, source)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+// secretHeaders are never printed as they are, since they carry credentials
+var secretHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+}
+
+// shellQuote quotes a string for POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// curlCommand formats a request as a curl command line, with secret header values redacted
+func curlCommand(req *http.Request) string {
+	var sb strings.Builder
+	sb.WriteString("curl -L")
+	if req.Method == http.MethodHead {
+		sb.WriteString(" -I")
+	} else if req.Method != http.MethodGet {
+		sb.WriteString(" -X " + req.Method)
+	}
+	keys := make([]string, 0, len(req.Header))
+	for key := range req.Header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range req.Header[key] {
+			if secretHeaders[key] {
+				value = "REDACTED"
+			}
+			sb.WriteString(" -H " + shellQuote(key+": "+value))
+		}
+	}
+	sb.WriteString(" " + shellQuote(req.URL.String()))
+	return sb.String()
+}
+
+// writeRequestScript writes the manifest request and the blob requests for each model as curl commands.
+// Only the manifests are fetched, since they say which blobs there are, and no blob is downloaded.
+// The Authorization headers are the ones the client would send after fetching the manifest, redacted.
+func writeRequestScript(ctx context.Context, w io.Writer, client ollamaurl.Registry, modelNames []string, opts options) error {
+	fmt.Fprintln(w, "#!/bin/sh")
+	for _, modelName := range modelNames {
+		ref, manifest, err := fetchManifest(ctx, client, modelName, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", modelName, err)
+		}
+		repository := ref.Path()
+		req, err := client.ManifestRequest(ctx, repository, ref.Reference())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "\n# Manifest for %s\n", modelName)
+		fmt.Fprintln(w, curlCommand(req))
+
+		layers := manifest.Layers
+		if manifest.Config.Digest != "" {
+			layers = append([]ollamaurl.Layer{manifest.Config}, layers...)
+		}
+		for _, layer := range layers {
+			req, err := client.BlobRequest(ctx, repository, layer.Digest)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "\n# %s (%s)\n", shortMediaType(layer.MediaType), humanSize(layer.Size))
+			fmt.Fprintln(w, curlCommand(req))
+		}
+	}
+	return nil
+}
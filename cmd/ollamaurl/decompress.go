@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decompressBlob writes the decompressed contents of r to w.
+// The compression format is detected from the first bytes, not from the media type.
+func decompressBlob(r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		_, err = io.Copy(w, zr)
+		return err
+	case bytes.HasPrefix(magic, zstdMagic):
+		return errors.New("zstd compressed blobs are not supported")
+	default:
+		return errors.New("the blob is not gzip compressed")
+	}
+}
+
+// streamBlobDecompressed is like DownloadBlob, but writes the decompressed blob to w.
+// The digest is still checked over the compressed bytes, as they were received from the registry,
+// and the progress counts them too, since that is the size that is known up front.
+func streamBlobDecompressed(ctx context.Context, client ollamaurl.Registry, repository, digest string, size int64, opts options, w io.Writer) error {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := decompressBlob(pr, w)
+		// Unblock DownloadBlob if decompression stopped early
+		pr.CloseWithError(err)
+		done <- err
+	}()
+	out, finish := opts.withProgress(pw, digest, size)
+	_, err := ollamaurl.DownloadBlob(ctx, client, repository, digest, out)
+	finish()
+	pw.CloseWithError(err)
+	if derr := <-done; err == nil && derr != nil {
+		return fmt.Errorf("decompressing blob %s: %w", digest, derr)
+	}
+	return err
+}
+
+// isCompressedMediaType reports if the media type says that the blob is gzip compressed
+func isCompressedMediaType(mediaType string) bool {
+	return strings.HasSuffix(mediaType, "+gzip")
+}
+
+// checkDecompress returns an error if --decompress is given for a blob with a +zstd media type.
+// zstd is not supported, and the layer should not end up on disk compressed without a word.
+func (o options) checkDecompress(digest, mediaType string) error {
+	if o.decompress && strings.HasSuffix(mediaType, "+zstd") {
+		return fmt.Errorf("layer %s is zstd compressed (%s), which --decompress does not support, download it without --decompress and use zstd -d", digest, mediaType)
+	}
+	return nil
+}
+
+// shouldDecompress reports if blobs with this media type were asked to be decompressed on download,
+// either by --decompress or by being listed in --decompress-media-types
+func (o options) shouldDecompress(mediaType string) bool {
+	return (o.decompress && isCompressedMediaType(mediaType)) || slices.Contains(o.decompressMediaTypes, mediaType)
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+// withProgress wraps w in a progress reporter for a single blob, unless progress is turned off.
+// When there is a reporter for all the blobs of a download, the bytes are counted by that one instead.
+// The returned function must be called when the download is done.
+func (o options) withProgress(w io.Writer, digest string, total int64) (io.Writer, func()) {
+	if o.totalProgress != nil {
+		return io.MultiWriter(w, o.totalProgress), func() {}
+	}
+	if o.progress == progressNone {
+		return w, func() {}
+	}
+	progress := startProgress(w, os.Stderr, o.progress, digest, total)
+	return progress, progress.finish
+}
+
+// retryOnVerifyFailure calls download, and calls it again up to retries times
+// for as long as it fails because the data did not match the digest
+func retryOnVerifyFailure(retries int, download func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := download()
+		if err == nil || attempt >= retries || !errors.Is(err, ollamaurl.ErrDigestMismatch) {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v, downloading it again (%d of %d)\n", err, attempt+1, retries)
+	}
+}
+
+// downloadLayer writes a layer to w, decompressed if its media type was asked for.
+// When a failed verification should lead to a new download, the blob goes to a temporary
+// file first, since nothing can be taken back once it has been written to w.
+func downloadLayer(ctx context.Context, client ollamaurl.Registry, repository string, layer ollamaurl.Layer, opts options, w io.Writer) error {
+	if err := opts.checkDecompress(layer.Digest, layer.MediaType); err != nil {
+		return err
+	}
+	decompress := opts.shouldDecompress(layer.MediaType)
+
+	if opts.verifyRetries == 0 {
+		if decompress {
+			return streamBlobDecompressed(ctx, client, repository, layer.Digest, layer.Size, opts, w)
+		}
+		w, finish := opts.withProgress(w, layer.Digest, layer.Size)
+		defer finish()
+		_, err := ollamaurl.DownloadBlob(ctx, client, repository, layer.Digest, w)
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", "ollamaurl-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	err = retryOnVerifyFailure(opts.verifyRetries, func() error {
+		if err := tmp.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		out, finish := opts.withProgress(tmp, layer.Digest, layer.Size)
+		defer finish()
+		_, err := ollamaurl.DownloadBlob(ctx, client, repository, layer.Digest, out)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if decompress {
+		if err := decompressBlob(tmp, w); err != nil {
+			return fmt.Errorf("decompressing blob %s: %w", layer.Digest, err)
+		}
+		return nil
+	}
+	_, err = io.Copy(w, tmp)
+	return err
+}
+
+// blobConcurrency is the number of blobs to download at the same time. With -V, every blob has a
+// progress bar of its own and the verbose messages go straight to stdout, so then it is one.
+func (o options) blobConcurrency() int {
+	if o.verbose {
+		return 1
+	}
+	return o.concurrency
+}
+
+const (
+	// partSuffix is added to the filename of a blob while it is being downloaded
+	partSuffix = ".part"
+
+	// decompressedSuffix is added to the filename of a decompressed blob, since the file no longer
+	// matches the digest in its name, and --verify should not take it for the blob
+	decompressedSuffix = ".decompressed"
+)
+
+// downloadResult is what happened to one file of a download to disk
+type downloadResult struct {
+	filename     string
+	skipped      bool
+	resumed      bool
+	decompressed bool
+	notStarted   bool // the run was stopped before the download could start
+	err          error
+}
+
+// isDownloaded reports if there already is a file for the blob in dir with the expected size
+// and digest. A file of the right size that does not match the digest is reported on stderr.
+func isDownloaded(dir string, blob ollamaurl.Blob) bool {
+	fi, err := os.Stat(filepath.Join(dir, blob.Filename))
+	if err != nil || blob.Size <= 0 || fi.Size() != blob.Size {
+		return false
+	}
+	if err := verifyBlobFile(dir, blob); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s is already there, but does not match its digest (%v), downloading it again\n", filepath.Join(dir, blob.Filename), err)
+		return false
+	}
+	return true
+}
+
+// downloadedBlobs checks which blobs are already in dir with isDownloaded, hashing up to
+// concurrency files at the same time. Blobs that are decompressed are never downloaded already.
+func downloadedBlobs(dir string, blobs []ollamaurl.Blob, opts options) []bool {
+	downloaded := make([]bool, len(blobs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(1, min(opts.concurrency, len(blobs))) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				downloaded[i] = !opts.shouldDecompress(blobs[i].MediaType) && isDownloaded(dir, blobs[i])
+			}
+		}()
+	}
+	for i := range blobs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return downloaded
+}
+
+// resumeOffset returns how much of a blob there already is in its .part file, or 0 if the
+// download should start from scratch
+func resumeOffset(partname string, size int64, opts options) int64 {
+	if opts.noResume {
+		return 0
+	}
+	fi, err := os.Stat(partname)
+	if err != nil || size <= 0 || fi.Size() >= size {
+		return 0
+	}
+	return fi.Size()
+}
+
+// resumePart continues a download into the .part file from the given offset, or from scratch if the
+// registry ignores the range. The whole file is then checked against the digest, so that a broken
+// .part file from an earlier run does not end up as the blob. It reports if it could resume.
+func resumePart(ctx context.Context, client ollamaurl.Registry, repository string, blob ollamaurl.Blob, partname string, offset int64, opts options) (bool, error) {
+	f, err := os.OpenFile(partname, os.O_RDWR, 0)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	body, start, err := client.GetBlobFrom(ctx, repository, blob.Digest, offset)
+	if err != nil {
+		return false, err
+	}
+	defer body.Close()
+	if opts.verbose {
+		if start > 0 {
+			fmt.Printf("Resuming %s from byte %d\n", blob.Filename, start)
+		} else {
+			fmt.Printf("The registry ignored the range, downloading %s from the start\n", blob.Filename)
+		}
+	}
+	if err := f.Truncate(start); err != nil {
+		return false, err
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return false, err
+	}
+
+	out, finish := opts.withProgress(f, blob.Digest, blob.Size-start)
+	n, err := io.Copy(out, body)
+	finish()
+	if err != nil {
+		return false, fmt.Errorf("streaming blob %s: %w", blob.Digest, err)
+	}
+	if start+n != blob.Size {
+		os.Remove(partname)
+		return false, fmt.Errorf("got %d bytes for blob %s, but the manifest says %d", start+n, blob.Digest, blob.Size)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	if err := client.VerifyBlob(blob.Digest, f); err != nil {
+		os.Remove(partname)
+		return false, err
+	}
+	return start > 0, nil
+}
+
+// downloadBlobFile downloads a blob to dir, unless it is already downloaded, as found by downloadedBlobs.
+// The data goes to a .part file first, which is renamed once the digest has been verified.
+// A .part file that is left over from an interrupted download is resumed, unless --no-resume is given.
+// A blob that is decompressed is written to its filename with decompressedSuffix, and is always
+// downloaded again, since its file says nothing about the digest.
+func downloadBlobFile(ctx context.Context, client ollamaurl.Registry, repository string, blob ollamaurl.Blob, dir string, downloaded bool, opts options) downloadResult {
+	result := downloadResult{filename: filepath.Join(dir, blob.Filename)}
+	if opts.shouldDecompress(blob.MediaType) {
+		result.filename += decompressedSuffix
+		result.decompressed = true
+		result.err = retryOnVerifyFailure(opts.verifyRetries, func() error {
+			return writeFileAtomic(result.filename, func(f io.Writer) error {
+				return streamBlobDecompressed(ctx, client, repository, blob.Digest, blob.Size, opts, f)
+			})
+		})
+		return result
+	}
+	if downloaded {
+		result.skipped = true
+		return result
+	}
+
+	partname := result.filename + partSuffix
+	result.err = retryOnVerifyFailure(opts.verifyRetries, func() error {
+		if offset := resumeOffset(partname, blob.Size, opts); offset > 0 {
+			resumed, err := resumePart(ctx, client, repository, blob, partname, offset, opts)
+			if err != nil {
+				return err
+			}
+			result.resumed = resumed
+			return os.Rename(partname, result.filename)
+		}
+
+		f, err := os.Create(partname)
+		if err != nil {
+			return err
+		}
+		out, finish := opts.withProgress(f, blob.Digest, blob.Size)
+		n, err := ollamaurl.DownloadBlob(ctx, client, repository, blob.Digest, out)
+		finish()
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil && blob.Size > 0 && n != blob.Size {
+			err = fmt.Errorf("got %d bytes for blob %s, but the manifest says %d", n, blob.Digest, blob.Size)
+		}
+		if err != nil {
+			// What was received of an interrupted download can be resumed, but not data that is wrong
+			if errors.Is(err, ollamaurl.ErrDigestMismatch) || (blob.Size > 0 && n >= blob.Size) {
+				os.Remove(partname)
+			}
+			return err
+		}
+		return os.Rename(partname, result.filename)
+	})
+	return result
+}
+
+// unfinishedBlob names a blob that did not finish, with its digest if the filename does not have
+// it, and whether it was being downloaded or not started yet
+func unfinishedBlob(blob ollamaurl.Blob, result downloadResult) string {
+	name := blob.Filename
+	if name != ollamaurl.CreateFilename(blob.Digest) {
+		name += " (" + blob.Digest + ")"
+	}
+	if result.notStarted {
+		return name + " not started"
+	}
+	return name + " in flight"
+}
+
+// downloadToDir downloads every blob of the plan to dir, and writes the manifest there as it was
+// received. Up to --concurrency blobs are downloaded at the same time, each to its own file and with
+// its own retries. All blobs are tried, even if some fail. The written, skipped and failed files are
+// listed on w in the order of the plan, followed by a summary. If the run is stopped, like by
+// --deadline, the error lists the blobs that were in flight or not started yet.
+func downloadToDir(ctx context.Context, client ollamaurl.Registry, plan *ollamaurl.Plan, manifest *ollamaurl.Manifest, dir string, opts options, w io.Writer) error {
+	for _, blob := range plan.Blobs {
+		if err := opts.checkDecompress(blob.Digest, blob.MediaType); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	repository := ollamaurl.ModelRef{Namespace: plan.Namespace, Repository: plan.Repository}.Path()
+
+	// A blob that is listed twice is only downloaded once, so that no two workers write the same file
+	var blobs []ollamaurl.Blob
+	seen := make(map[string]bool)
+	manifestFilename := ollamaurl.ManifestFilename
+	for _, blob := range plan.Blobs {
+		if blob.IsManifest() {
+			manifestFilename = blob.Filename
+			continue
+		}
+		if !seen[blob.Filename] {
+			seen[blob.Filename] = true
+			blobs = append(blobs, blob)
+		}
+	}
+
+	// A file that is already there is only skipped if it matches its digest, not just its size
+	present := downloadedBlobs(dir, blobs, opts)
+
+	// Without -V, there is a single progress bar for what is left to download of all the blobs
+	if opts.progress == progressBar && !opts.verbose {
+		var remaining int64
+		for i, blob := range blobs {
+			filename := filepath.Join(dir, blob.Filename)
+			switch {
+			case opts.shouldDecompress(blob.MediaType):
+				remaining += blob.Size
+			case !present[i]:
+				remaining += blob.Size - resumeOffset(filename+partSuffix, blob.Size, opts)
+			}
+		}
+		opts.totalProgress = startProgress(io.Discard, os.Stderr, progressBar, plan.Model, remaining)
+	}
+
+	results := make([]downloadResult, len(blobs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(1, min(opts.blobConcurrency(), len(blobs))) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil && !present[i] {
+					results[i] = downloadResult{filename: filepath.Join(dir, blobs[i].Filename), notStarted: true, err: context.Cause(ctx)}
+					continue
+				}
+				results[i] = downloadBlobFile(ctx, client, repository, blobs[i], dir, present[i], opts)
+			}
+		}()
+	}
+	for i := range blobs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	if opts.totalProgress != nil {
+		// End the progress bar before the list of files
+		opts.totalProgress.finish()
+		opts.totalProgress = nil
+	}
+
+	var (
+		errs       []error
+		unfinished []string // the blobs that were stopped by --deadline, or by a fatal error
+	)
+	stopped := ctx.Err() != nil
+	downloaded, skipped := 0, 0
+	for i, result := range results {
+		switch {
+		case result.err != nil && stopped:
+			errs = append(errs, fmt.Errorf("%s: %w", blobs[i].Filename, result.err))
+			unfinished = append(unfinished, unfinishedBlob(blobs[i], result))
+			fmt.Fprintf(w, "Did not finish %s\n", result.filename)
+			continue
+		case result.err != nil:
+			errs = append(errs, fmt.Errorf("%s: %w", blobs[i].Filename, result.err))
+			fmt.Fprintf(w, "Failed to download %s\n", result.filename)
+			continue
+		case result.skipped:
+			skipped++
+			fmt.Fprintf(w, "Skipped %s, it is already there and matches its digest\n", result.filename)
+			continue
+		case result.decompressed:
+			fmt.Fprintf(w, "Downloaded and decompressed %s\n", result.filename)
+		case result.resumed:
+			fmt.Fprintf(w, "Resumed and downloaded %s\n", result.filename)
+		default:
+			fmt.Fprintf(w, "Downloaded %s\n", result.filename)
+		}
+		downloaded++
+	}
+	fmt.Fprintf(w, "%d downloaded, %d skipped, %d failed\n", downloaded, skipped, len(errs))
+	if len(unfinished) > 0 {
+		// The blobs all failed for the same reason, which the caller reports, so only say which they are
+		return fmt.Errorf("%d of %d blobs did not finish: %s", len(unfinished), len(blobs), strings.Join(unfinished, ", "))
+	}
+	if len(errs) > 0 {
+		// Without all the blobs, the manifest would only be misleading
+		return errors.Join(errs...)
+	}
+
+	manifestPath := filepath.Join(dir, manifestFilename)
+	err := writeFileAtomic(manifestPath, func(f io.Writer) error {
+		_, err := f.Write(manifest.Raw)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	fmt.Fprintf(w, "Wrote %s\n", manifestPath)
+	return nil
+}
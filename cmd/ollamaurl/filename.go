@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+// filenameFields are the fields that a --filename-template can use
+type filenameFields struct {
+	Model       string // the repository, like "tinyllama"
+	Tag         string // empty when the model is pinned by digest
+	Digest      string // like "sha256:<hex>"
+	ShortDigest string // the first 12 hex digits of the digest
+	MediaType   string
+	Index       int // the position of the blob in the plan, starting at 0 with the config, or with the first layer when --ignore-config is given
+}
+
+// parseFilenameTemplate parses a --filename-template and tries it out, so that an unknown field
+// is reported before anything is fetched
+func parseFilenameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("filename").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --filename-template: %w", err)
+	}
+	sample := filenameFields{Model: "model", Tag: "latest", Digest: "sha256:0", ShortDigest: "0", MediaType: ollamaurl.ModelMediaType}
+	if err := tmpl.Execute(&bytes.Buffer{}, sample); err != nil {
+		return nil, fmt.Errorf("invalid --filename-template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// applyFilenameTemplate renames every blob in the plan, except the manifest, after the template.
+// Each name must be a plain filename, and no two blobs may get the same one, or the name of
+// the manifest, which a layer would then overwrite.
+func applyFilenameTemplate(plan *ollamaurl.Plan, tmpl *template.Template) error {
+	used := make(map[string]string)
+	for _, blob := range plan.Blobs {
+		if blob.IsManifest() {
+			used[blob.Filename] = "the manifest"
+		}
+	}
+	for i := range plan.Blobs {
+		blob := &plan.Blobs[i]
+		if blob.IsManifest() {
+			continue
+		}
+		_, hash, _ := strings.Cut(blob.Digest, ":")
+		fields := filenameFields{
+			Model:       plan.Repository,
+			Tag:         plan.Tag,
+			Digest:      blob.Digest,
+			ShortDigest: hash[:min(12, len(hash))],
+			MediaType:   blob.MediaType,
+			Index:       i,
+		}
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, fields); err != nil {
+			return fmt.Errorf("naming blob %s: %w", blob.Digest, err)
+		}
+		filename := sb.String()
+		if filename == "" || filename == "." || filename == ".." || strings.ContainsAny(filename, "/\\\x00") {
+			return fmt.Errorf("--filename-template gives %q for blob %s, which is not a plain filename", filename, blob.Digest)
+		}
+		if other, found := used[filename]; found {
+			return fmt.Errorf("--filename-template gives %s for both %s and %s", filename, other, blob.Digest)
+		}
+		used[filename] = blob.Digest
+		blob.Filename = filename
+	}
+	return nil
+}
+
+// blobSource returns the URL of a blob, prefixed with "filename::" if --filename-template gave it
+// another name than the usual one
+func blobSource(blob ollamaurl.Blob) string {
+	if blob.Filename != ollamaurl.CreateFilename(blob.Digest) {
+		return blob.Filename + "::" + blob.URL
+	}
+	return blob.URL
+}
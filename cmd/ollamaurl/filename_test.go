@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestApplyFilenameTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     []string // the filenames, the manifest last
+		wantErr  bool
+	}{
+		{"short digest", "{{.Model}}-{{.Tag}}-{{.ShortDigest}}.bin", []string{
+			"tinyllama-latest-cccccccccccc.bin",
+			"tinyllama-latest-111111111111.bin",
+			"tinyllama-latest-222222222222.bin",
+			"tinyllama-latest-333333333333.bin",
+			"manifest.json",
+		}, false},
+		{"index", "{{.Index}}.bin", []string{"0.bin", "1.bin", "2.bin", "3.bin", "manifest.json"}, false},
+		{"same name", "{{.Model}}.bin", nil, true},
+		{"name of the manifest", "{{if eq .Index 1}}manifest.json{{else}}{{.Index}}{{end}}", nil, true},
+		{"not a plain filename", "{{.Model}}/{{.Index}}", nil, true},
+		{"empty", "{{if false}}x{{end}}", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOptions()
+			tmpl, err := parseFilenameTemplate(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts.filenameTemplate = tmpl
+			plan, err := fetchPlan(context.Background(), newFakeRegistry(), "tinyllama", opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error for %q", tt.template)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, blob := range plan.Blobs {
+				if i >= len(tt.want) || blob.Filename != tt.want[i] {
+					t.Errorf("blob %d is %s, want %q", i, blob.Filename, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+// annotationSelector matches layers that have an annotation key, and optionally a specific value for it
+type annotationSelector struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+// parseAnnotationSelectors parses "key" and "key=value" arguments
+func parseAnnotationSelectors(args []string) ([]annotationSelector, error) {
+	selectors := make([]annotationSelector, 0, len(args))
+	for _, arg := range args {
+		key, value, hasValue := strings.Cut(arg, "=")
+		if key = strings.TrimSpace(key); key == "" {
+			return nil, fmt.Errorf("invalid annotation selector %q, expected key or key=value", arg)
+		}
+		selectors = append(selectors, annotationSelector{key: key, value: value, hasValue: hasValue})
+	}
+	return selectors, nil
+}
+
+func (s annotationSelector) matches(layer ollamaurl.Layer) bool {
+	value, found := layer.Annotations[s.key]
+	return found && (!s.hasValue || value == s.value)
+}
+
+// filterLayers keeps the layers that match any of the annotation selectors.
+// The config layer is not affected. Without selectors, all layers are kept. With verbose, the
+// skipped layers are reported on stderr, so that they do not end up in JSON or other output.
+func filterLayers(manifest *ollamaurl.Manifest, selectors []annotationSelector, verbose bool) {
+	if len(selectors) == 0 {
+		return
+	}
+	kept := manifest.Layers[:0]
+	for _, layer := range manifest.Layers {
+		matched := false
+		for _, selector := range selectors {
+			if selector.matches(layer) {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			kept = append(kept, layer)
+		} else if verbose {
+			fmt.Fprintf(os.Stderr, "Skipping layer without a matching annotation: digest = %s\n", layer.Digest)
+		}
+	}
+	manifest.Layers = kept
+}
+
+// filterMediaTypes keeps the layers that have one of the given media types.
+// The config layer is not affected. Without media types, all layers are kept.
+func filterMediaTypes(manifest *ollamaurl.Manifest, mediaTypes []string, verbose bool) {
+	if len(mediaTypes) == 0 {
+		return
+	}
+	kept := manifest.Layers[:0]
+	for _, layer := range manifest.Layers {
+		if slices.Contains(mediaTypes, layer.MediaType) {
+			kept = append(kept, layer)
+		} else if verbose {
+			fmt.Fprintf(os.Stderr, "Skipping layer with media type %s: digest = %s\n", layer.MediaType, layer.Digest)
+		}
+	}
+	manifest.Layers = kept
+}
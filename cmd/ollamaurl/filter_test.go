@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+func TestFilterLayers(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations []string
+		mediaTypes  []string
+		want        []string // the digests of the layers that are kept
+	}{
+		{"no filter", nil, nil, []string{testDigest("1"), testDigest("2"), testDigest("3")}},
+		{"annotation key", []string{"role"}, nil, []string{testDigest("1"), testDigest("3")}},
+		{"annotation value", []string{"role=weights"}, nil, []string{testDigest("1")}},
+		{"either annotation", []string{"role=weights", "role=legal"}, nil, []string{testDigest("1"), testDigest("3")}},
+		{"no matching annotation", []string{"role=other"}, nil, nil},
+		{"media type", nil, []string{ollamaurl.ModelMediaType}, []string{testDigest("1")}},
+		{"either media type", nil, []string{ollamaurl.ModelMediaType, ollamaurl.MediaTypePrefix + "template"}, []string{testDigest("1"), testDigest("2")}},
+		{"no matching media type", nil, []string{"application/octet-stream"}, nil},
+		{"annotation and media type", []string{"role"}, []string{ollamaurl.MediaTypePrefix + "license"}, []string{testDigest("3")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selectors, err := parseAnnotationSelectors(tt.annotations)
+			if err != nil {
+				t.Fatal(err)
+			}
+			manifest, err := newFakeRegistry().GetManifest(context.Background(), "library/tinyllama", "latest", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			filterLayers(manifest, selectors, false)
+			filterMediaTypes(manifest, tt.mediaTypes, false)
+			var got []string
+			for _, layer := range manifest.Layers {
+				got = append(got, layer.Digest)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if manifest.Config.Digest != testDigest("c") {
+				t.Errorf("the config was changed to %q", manifest.Config.Digest)
+			}
+		})
+	}
+}
+
+func TestParseAnnotationSelectors(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    annotationSelector
+		wantErr bool
+	}{
+		{"role", annotationSelector{key: "role"}, false},
+		{"role=weights", annotationSelector{key: "role", value: "weights", hasValue: true}, false},
+		{"role=", annotationSelector{key: "role", hasValue: true}, false},
+		{"role=a=b", annotationSelector{key: "role", value: "a=b", hasValue: true}, false},
+		{"=weights", annotationSelector{}, true},
+		{" ", annotationSelector{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, err := parseAnnotationSelectors([]string{tt.arg})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseAnnotationSelectors(%q) = %+v, want an error", tt.arg, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got[0] != tt.want {
+				t.Errorf("got %+v, want %+v", got[0], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+// Output formats for --format
+const (
+	formatText = "text"
+	formatGHA  = "gha"
+	formatSums = "sha256sum"
+	formatMake = "make"
+	formatNix  = "nix"
+	formatCSV  = "csv"
+	formatTSV  = "tsv"
+
+	// formatScript is selected with --script instead of --format
+	formatScript = "script"
+)
+
+var outputFormats = []string{formatText, formatGHA, formatSums, formatMake, formatNix, formatCSV, formatTSV}
+
+// tableColumns is the header row of --format=csv and --format=tsv
+var tableColumns = []string{"filename", "url", "digest", "size", "mediaType"}
+
+// Line styles for --format=sha256sum
+const (
+	checksumGNU = "gnu"
+	checksumBSD = "bsd"
+)
+
+var checksumFormats = []string{checksumGNU, checksumBSD}
+
+// Download tools for --script
+const (
+	scriptCurl = "curl"
+	scriptWget = "wget"
+)
+
+var scriptTools = []string{scriptCurl, scriptWget}
+
+// ghaMatrixEntry is one job in a GitHub Actions matrix
+type ghaMatrixEntry struct {
+	URL      string `json:"url"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size,omitempty"`
+}
+
+// writeGHAMatrix writes a single line of JSON that can be used as jobs.<id>.strategy.matrix,
+// with one "include" entry per blob, for example:
+//
+//	echo "matrix=$(ollamaurl --format=gha tinyllama)" >> "$GITHUB_OUTPUT"
+func writeGHAMatrix(w io.Writer, plan *ollamaurl.Plan) error {
+	matrix := struct {
+		Include []ghaMatrixEntry `json:"include"`
+	}{
+		Include: make([]ghaMatrixEntry, 0, len(plan.Blobs)),
+	}
+	for _, blob := range plan.Blobs {
+		matrix.Include = append(matrix.Include, ghaMatrixEntry{URL: blob.URL, Filename: blob.Filename, Size: blob.Size})
+	}
+	return json.NewEncoder(w).Encode(matrix)
+}
+
+// writeChecksums writes one line per blob that can be checked with "sha256sum -c" (gnu)
+// or "sha256 -c" on the BSDs (bsd). The hashes are taken from the digests. The manifest is
+// only included when the model is pinned by digest, since a manifest fetched by tag has no
+// digest in the plan.
+func writeChecksums(w io.Writer, plan *ollamaurl.Plan, style string) error {
+	for _, blob := range plan.Blobs {
+		algorithm, hash, ok := strings.Cut(blob.Digest, ":")
+		if !ok || algorithm != "sha256" {
+			continue
+		}
+		var err error
+		if style == checksumBSD {
+			_, err = fmt.Fprintf(w, "SHA256 (%s) = %s\n", blob.Filename, hash)
+		} else {
+			_, err = fmt.Fprintf(w, "%s  %s\n", hash, blob.Filename)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileEntry is a blob in the --json-by-filename output, where the filename is the key
+type fileEntry struct {
+	URL       string `json:"url"`
+	Digest    string `json:"digest,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	MediaType string `json:"mediaType,omitempty"`
+}
+
+// writeJSONByFilename writes the blobs as a JSON object keyed by filename
+func writeJSONByFilename(w io.Writer, plan *ollamaurl.Plan) error {
+	files := make(map[string]fileEntry, len(plan.Blobs))
+	for _, blob := range plan.Blobs {
+		files[blob.Filename] = fileEntry{URL: blob.URL, Digest: blob.Digest, Size: blob.Size, MediaType: blob.MediaType}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(files)
+}
+
+// makeEscape escapes a string for use in a Makefile recipe, where '$' must be doubled
+func makeEscape(s string) string {
+	return strings.ReplaceAll(s, "$", "$$")
+}
+
+// isMakeTarget reports if a filename can be a Makefile target as it is. Make has no quoting for
+// targets, and whitespace, ':', '#', '$', '%', '\\' and glob characters all mean something to it.
+// A leading '-' would be taken for an option by mv.
+func isMakeTarget(filename string) bool {
+	return filename != "" && filename[0] != '-' && !strings.ContainsFunc(filename, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-_.+,@", r)
+	})
+}
+
+// writeMakefile writes a Makefile with one target per blob, which downloads it to its filename
+// and checks its digest, and an "all" target for all of them, so that "make -j" can download
+// blobs in parallel. Each blob is downloaded to a .part file first, so that an interrupted or
+// broken download is not mistaken for a finished one on the next run.
+func writeMakefile(w io.Writer, plan *ollamaurl.Plan) error {
+	var targets []string
+	for _, blob := range plan.Blobs {
+		if !isMakeTarget(blob.Filename) {
+			return fmt.Errorf("%q can not be a Makefile target, use a --filename-template that only gives letters, digits and -_.+,@", blob.Filename)
+		}
+		targets = append(targets, blob.Filename)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Downloads %s\n\n", plan.Model)
+	sb.WriteString(".PHONY: all\n")
+	fmt.Fprintf(&sb, "all: %s\n", strings.Join(targets, " "))
+	for _, blob := range plan.Blobs {
+		fmt.Fprintf(&sb, "\n%s:\n", blob.Filename)
+		fmt.Fprintf(&sb, "\tcurl -fsSL -o '$@.part' %s\n", makeEscape(shellQuote(blob.URL)))
+		if algorithm, hash, ok := strings.Cut(blob.Digest, ":"); ok && algorithm == "sha256" {
+			fmt.Fprintf(&sb, "\techo '%s  $@.part' | sha256sum -c -\n", hash)
+		}
+		sb.WriteString("\tmv '$@.part' '$@'\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// nixString quotes a string for a Nix expression, where '\', '"' and "${" must be escaped
+func nixString(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", `\${`).Replace(s)
+	return `"` + s + `"`
+}
+
+// writeNix writes a Nix expression with a "srcs" attribute set, keyed by filename, with a
+// fetchurl call per blob. The sha256 hashes are taken from the digests. A manifest that is
+// fetched by tag has no fixed hash, so it uses builtins.fetchurl and is marked as such.
+func writeNix(w io.Writer, plan *ollamaurl.Plan) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Downloads %s\n", plan.Model)
+	sb.WriteString("{ fetchurl }:\n{\n  srcs = {\n")
+	for _, blob := range plan.Blobs {
+		algorithm, hash, ok := strings.Cut(blob.Digest, ":")
+		if !ok || algorithm != "sha256" {
+			sb.WriteString("    # The manifest is fetched by tag and can change, pin the model by digest for a fixed hash\n")
+			fmt.Fprintf(&sb, "    %s = builtins.fetchurl %s;\n", nixString(blob.Filename), nixString(blob.URL))
+			continue
+		}
+		fmt.Fprintf(&sb, "    %s = fetchurl {\n", nixString(blob.Filename))
+		fmt.Fprintf(&sb, "      url = %s;\n", nixString(blob.URL))
+		fmt.Fprintf(&sb, "      sha256 = %s;\n", nixString(hash))
+		sb.WriteString("    };\n")
+	}
+	sb.WriteString("  };\n}\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeScript writes a bash script that downloads every blob, and the manifest, to its filename
+// with curl or wget. It stops at the first download that fails, because of "set -e".
+func writeScript(w io.Writer, plan *ollamaurl.Plan, tool string) error {
+	var sb strings.Builder
+	sb.WriteString("#!/usr/bin/env bash\n")
+	fmt.Fprintf(&sb, "# Downloads %s\n", plan.Model)
+	sb.WriteString("set -e\n")
+	for i, blob := range plan.Blobs {
+		filename, url := shellQuote(blob.Filename), shellQuote(blob.URL)
+		fmt.Fprintf(&sb, "echo %s\n", shellQuote(fmt.Sprintf("Downloading %s (%d/%d)", blob.Filename, i+1, len(plan.Blobs))))
+		if tool == scriptWget {
+			fmt.Fprintf(&sb, "wget -O %s %s\n", filename, url)
+		} else {
+			fmt.Fprintf(&sb, "curl -fL -o %s %s\n", filename, url)
+		}
+	}
+	sb.WriteString("echo Done\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// isTableFormat reports if the format is one with a row per blob and a header row
+func isTableFormat(format string) bool {
+	return format == formatCSV || format == formatTSV
+}
+
+// newTableWriter returns a CSV writer for --format=csv, or one that separates the columns with tabs for --format=tsv
+func newTableWriter(w io.Writer, format string) *csv.Writer {
+	cw := csv.NewWriter(w)
+	if format == formatTSV {
+		cw.Comma = '\t'
+	}
+	return cw
+}
+
+// writeTableHeader writes the header row of --format=csv or --format=tsv
+func writeTableHeader(w io.Writer, format string) error {
+	cw := newTableWriter(w, format)
+	cw.Write(tableColumns)
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeTable writes a row per blob, with the columns of tableColumns, and the header row first
+// if header is set. The digest and size of the manifest are left empty when it is fetched by tag.
+func writeTable(w io.Writer, plan *ollamaurl.Plan, format string, header bool) error {
+	if header {
+		if err := writeTableHeader(w, format); err != nil {
+			return err
+		}
+	}
+	cw := newTableWriter(w, format)
+	for _, blob := range plan.Blobs {
+		size := ""
+		if blob.Size > 0 {
+			size = strconv.FormatInt(blob.Size, 10)
+		}
+		cw.Write([]string{blob.Filename, blob.URL, blob.Digest, size, blob.MediaType})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// streamedBlob is one line of --json-stream-blobs output
+type streamedBlob struct {
+	Model string `json:"model"`
+	ollamaurl.Blob
+}
+
+// writeBlobStream writes one compact JSON object per line and blob, each flushed
+// as soon as it is written, so that a consumer can start on the first blob right away.
+// os.Stdout is not buffered, so only buffered writers need flushing.
+func writeBlobStream(w io.Writer, plan *ollamaurl.Plan) error {
+	enc := json.NewEncoder(w)
+	for _, blob := range plan.Blobs {
+		if err := enc.Encode(streamedBlob{Model: plan.Model, Blob: blob}); err != nil {
+			return err
+		}
+		if f, ok := w.(interface{ Flush() error }); ok {
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
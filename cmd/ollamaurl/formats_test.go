@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+func TestIsMakeTarget(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     bool
+	}{
+		{"sha256-" + strings.Repeat("a", 64), true},
+		{"manifest.json", true},
+		{"tinyllama-latest-4e17c5d24134.bin", true},
+		{"model+v1,a@b", true},
+		{"", false},
+		{"two words", false},
+		{"a:b", false},
+		{"a#b", false},
+		{"$(shell rm -rf x)", false},
+		{"a%b", false},
+		{"a*b", false},
+		{"it's", false},
+		{"-x", false},
+	}
+	for _, tt := range tests {
+		if got := isMakeTarget(tt.filename); got != tt.want {
+			t.Errorf("isMakeTarget(%q) = %v, want %v", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestWriteMakefileRefusesTargets(t *testing.T) {
+	plan := &ollamaurl.Plan{Model: "tinyllama", Blobs: []ollamaurl.Blob{{URL: "https://registry.test/blob", Filename: "a b"}}}
+	if err := writeMakefile(io.Discard, plan); err == nil {
+		t.Error("expected an error for a filename with a space")
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+// defaultGGUFHeaderBytes is how much of the model layer --gguf reads by default
+const defaultGGUFHeaderBytes = 16 << 20
+
+// writeGGUFHeader writes the GGUF version, tensor count and metadata as text
+func writeGGUFHeader(w io.Writer, header *ollamaurl.GGUFHeader) {
+	fmt.Fprintf(w, "GGUF version %d, %d tensors, %d metadata entries\n", header.Version, header.TensorCount, len(header.Metadata))
+	for _, kv := range header.Metadata {
+		fmt.Fprintf(w, "%s: %s\n", kv.Key, kv.Value)
+	}
+}
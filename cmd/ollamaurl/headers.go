@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+// debugHeaders are the response headers that --json-include-headers adds to the JSON output.
+// Only these are included, so headers carrying credentials or session cookies are never shown.
+var debugHeaders = []string{"Content-Type", "Content-Length", "Docker-Content-Digest", "ETag"}
+
+// selectHeaders picks the debug headers out of a response
+func selectHeaders(header http.Header) map[string]string {
+	selected := make(map[string]string)
+	for _, name := range debugHeaders {
+		if value := header.Get(name); value != "" {
+			selected[name] = value
+		}
+	}
+	return selected
+}
+
+// addResponseHeaders fills in the headers of every blob in the plan. The blobs are asked for with
+// HEAD requests, while the manifest headers are the ones that came with the manifest.
+func addResponseHeaders(ctx context.Context, client ollamaurl.Registry, plan *ollamaurl.Plan, manifest *ollamaurl.Manifest) error {
+	repository := ollamaurl.ModelRef{Namespace: plan.Namespace, Repository: plan.Repository}.Path()
+	errs := make([]error, len(plan.Blobs))
+	semaphore := make(chan struct{}, headConcurrency)
+	var wg sync.WaitGroup
+	for i := range plan.Blobs {
+		blob := &plan.Blobs[i]
+		if blob.IsManifest() {
+			// A cached manifest has no headers
+			if manifest.Headers != nil {
+				blob.Headers = selectHeaders(manifest.Headers)
+			}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			header, err := client.BlobHeaders(ctx, repository, blob.Digest)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			blob.Headers = selectHeaders(header)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// isTokenChar reports if r may be used in a header name
+func isTokenChar(r rune) bool {
+	return r < 0x80 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", r))
+}
+
+// parseRequestHeader parses a --header argument like "Key: Value"
+func parseRequestHeader(arg string) (string, string, error) {
+	key, value, found := strings.Cut(arg, ":")
+	if !found || key == "" || strings.IndexFunc(key, func(r rune) bool { return !isTokenChar(r) }) >= 0 {
+		return "", "", fmt.Errorf("invalid header %q, expected \"Key: Value\"", arg)
+	}
+	if strings.ContainsAny(value, "\r\n\x00") {
+		return "", "", fmt.Errorf("invalid header %q, the value can not contain line breaks", key)
+	}
+	return key, strings.TrimSpace(value), nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+// infoJSON is the --info --json output, the decoded manifest along with its digest and the
+// platform it was picked for, which are not fields of the manifest itself
+type infoJSON struct {
+	Digest   string `json:"digest,omitempty"`
+	Platform string `json:"platform,omitempty"`
+	*ollamaurl.Manifest
+}
+
+// writeInfo writes a human readable summary of a manifest for --info: its digest, schema version
+// and media type, the config, and a line per layer with its index, media type and size, followed
+// by the total. With --json, the decoded manifest is written with its digest.
+func writeInfo(w io.Writer, ref ollamaurl.ModelRef, manifest *ollamaurl.Manifest, opts options) error {
+	if opts.json {
+		info := infoJSON{Digest: manifest.Digest, Manifest: manifest}
+		if manifest.Platform != nil {
+			info.Platform = manifest.Platform.String()
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Model:\t%s\n", ref)
+	if manifest.Digest != "" {
+		fmt.Fprintf(tw, "Digest:\t%s\n", manifest.Digest)
+	}
+	if manifest.Platform != nil {
+		fmt.Fprintf(tw, "Platform:\t%s\n", manifest.Platform)
+	}
+	fmt.Fprintf(tw, "Schema version:\t%d\n", manifest.SchemaVersion)
+	if manifest.MediaType != "" {
+		fmt.Fprintf(tw, "Media type:\t%s\n", manifest.MediaType)
+	}
+	total := manifest.Config.Size
+	if manifest.Config.Digest != "" {
+		fmt.Fprintf(tw, "Config:\t%s (%s)\n", manifest.Config.Digest, humanSize(manifest.Config.Size))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Layers:\n")
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for i, layer := range manifest.Layers {
+		fmt.Fprintf(tw, "  %d\t%s\t%s\t%s\n", i, shortMediaType(layer.MediaType), humanSize(layer.Size), layer.Digest)
+		total += layer.Size
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	noun := "layers"
+	if len(manifest.Layers) == 1 {
+		noun = "layer"
+	}
+	if manifest.Config.Digest != "" {
+		noun += " and the config"
+	}
+	_, err := fmt.Fprintf(w, "Total: %s (%d bytes) in %d %s\n", humanSize(total), total, len(manifest.Layers), noun)
+	return err
+}
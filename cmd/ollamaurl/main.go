@@ -0,0 +1,1150 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/xyproto/ollamaurl"
+)
+
+const (
+	versionString = "ollamaurl 1.0.1"
+
+	// registryEnvVar sets the registry when --registry is not given
+	registryEnvVar = "OLLAMA_REGISTRY"
+)
+
+var (
+	errPKGBUILDDrift = errors.New("the PKGBUILD does not match the manifest")
+	errVerifyFailed  = errors.New("some blobs did not match their digests")
+)
+
+// options holds the settings that affect how each model is processed
+type options struct {
+	verbose       bool
+	update        bool
+	dryRun        bool
+	layer         string
+	download      bool
+	ignoreConfig  bool
+	defaults      ollamaurl.ModelDefaults
+	countFormat   string
+	headOnly      bool
+	sizes         bool
+	gguf          bool
+	ggufBytes     int64
+	annotations   []annotationSelector
+	mediaTypes    []string
+	relativeURLs  bool
+	check         bool
+	verifyDir     string
+	concurrency   int
+	withSize      bool
+	print0        bool
+	listBlobsJSON bool
+	json          bool
+	format        string
+	referrers     bool
+	expectDigest  string
+	verifyKey     crypto.PublicKey
+	printRef      bool
+	expectLayers  int // -1 when not given
+
+	decompress           bool
+	decompressMediaTypes []string
+	checksumFormat       string
+	scriptTool           string
+	includeHeaders       bool
+	total                *GrandTotal // nil unless --grand-total is given
+	metadataDirs         *outputFileNamer
+	strictMediaTypes     bool
+	progress             string
+	quiet                bool
+	summary              bool              // a footer after the URLs, when they are written to a terminal
+	totalProgress        *progressReporter // set while downloading the blobs of a model without -V
+	verifyRetries        int
+	noResume             bool
+	jsonByFilename       bool
+	repeatableOrder      bool
+	jsonStream           bool
+	downloadDir          string // set for --download without --stdout
+	timeout              time.Duration
+	saveManifestDir      string
+	pkgbuildPath         string
+	printID              bool
+	tableHeader          bool // the output of each model starts with the header row of --format=csv or tsv
+	listTags             bool
+	info                 bool
+	latestDigest         bool
+	filenameTemplate     *template.Template // nil for the sha256-<hex> filenames
+}
+
+// processModel fetches the manifest for a single model and writes the requested output to w
+func processModel(ctx context.Context, client ollamaurl.Registry, modelName string, opts options, w io.Writer) error {
+	if opts.listTags {
+		return writeTags(ctx, client, modelName, opts, w)
+	}
+	if opts.latestDigest {
+		return writeLatestDigest(ctx, client, modelName, opts, w)
+	}
+
+	ref, manifest, err := fetchManifest(ctx, client, modelName, opts)
+	if err != nil {
+		return err
+	}
+	// With mirrors, the blobs come from the registry that served the manifest
+	baseURL := manifest.Registry
+	repository := ref.Path()
+
+	if opts.saveManifestDir != "" {
+		manifestPath, err := writeManifestFile(opts.saveManifestDir, ref, manifest)
+		if err != nil {
+			return err
+		}
+		if opts.verbose {
+			fmt.Printf("Saved the manifest to %s\n", manifestPath)
+		}
+	}
+
+	if opts.metadataDirs != nil {
+		return writeMetadata(ctx, client, ref, manifest, opts, w)
+	}
+
+	if opts.info {
+		return writeInfo(w, ref, manifest, opts)
+	}
+
+	if opts.printID {
+		id, err := ollamaurl.ModelID(manifest.Raw)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%s\n", id, modelName)
+		return nil
+	}
+
+	if opts.countFormat != "" {
+		if err := writeMediaTypeSummary(w, countByMediaType(manifest), opts.countFormat); err != nil {
+			return fmt.Errorf("writing summary: %w", err)
+		}
+		return nil
+	}
+
+	if opts.headOnly {
+		total, unknown, err := headTotal(ctx, client, repository, manifest)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Total: %s (%d bytes) according to the registry\n", humanSize(total), total)
+		if unknown > 0 {
+			fmt.Fprintf(w, "Warning: %d blobs had no Content-Length, the total is incomplete\n", unknown)
+		}
+		return nil
+	}
+
+	if opts.sizes {
+		return writeSizes(ctx, w, client, repository, manifest)
+	}
+
+	if opts.referrers {
+		referrers, err := client.GetReferrers(ctx, repository, manifest.Digest)
+		if err != nil {
+			return err
+		}
+		if opts.repeatableOrder {
+			sortReferrers(referrers)
+		}
+		writeReferrers(w, manifest.Digest, referrers)
+		return nil
+	}
+
+	if opts.gguf {
+		layer, err := ollamaurl.ModelLayer(manifest)
+		if opts.layer != "" {
+			layer, err = ollamaurl.SelectLayer(manifest, opts.layer)
+		}
+		if err != nil {
+			return fmt.Errorf("selecting layer: %w", err)
+		}
+		if opts.verbose {
+			fmt.Printf("Reading up to %s of the GGUF header from layer %s\n", humanSize(opts.ggufBytes), layer.Digest)
+		}
+		body, err := client.GetBlobRange(ctx, repository, layer.Digest, opts.ggufBytes)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		header, err := ollamaurl.ParseGGUFHeader(body)
+		if err != nil {
+			return fmt.Errorf("%w (try a larger --gguf-header-size)", err)
+		}
+		writeGGUFHeader(w, header)
+		return nil
+	}
+
+	if opts.layer != "" {
+		layer, err := ollamaurl.SelectLayer(manifest, opts.layer)
+		if err != nil {
+			return fmt.Errorf("selecting layer: %w", err)
+		}
+		if opts.download {
+			if err := downloadLayer(ctx, client, repository, layer, opts, w); err != nil {
+				return fmt.Errorf("downloading blob: %w", err)
+			}
+			return nil
+		}
+		blobURL := ollamaurl.ConstructBlobURL(baseURL, repository, layer.Digest)
+		if opts.relativeURLs {
+			blobURL = ollamaurl.RelativeURL(baseURL, blobURL)
+		}
+		_, err = fmt.Fprintln(w, blobURL)
+		return err
+	}
+
+	plan := ollamaurl.NewPlan(baseURL, modelName, ref, manifest, opts.verbose)
+	if opts.filenameTemplate != nil {
+		if err := applyFilenameTemplate(plan, opts.filenameTemplate); err != nil {
+			return err
+		}
+	}
+
+	if opts.downloadDir != "" {
+		if opts.quiet {
+			// The files that were downloaded are only listed for the information
+			w = io.Discard
+		}
+		return downloadToDir(ctx, client, plan, manifest, opts.downloadDir, opts, w)
+	}
+
+	if opts.verifyDir != "" {
+		if writeVerifyResults(w, verifyBlobs(opts.verifyDir, plan.Blobs, opts.concurrency)) > 0 {
+			return errVerifyFailed
+		}
+		return nil
+	}
+
+	if opts.check {
+		drift, err := checkPKGBUILD(opts.pkgbuildPath, plan.Blobs)
+		if err != nil {
+			return err
+		}
+		for _, line := range drift {
+			fmt.Fprintln(w, line)
+		}
+		if len(drift) > 0 {
+			return errPKGBUILDDrift
+		}
+		if opts.verbose {
+			fmt.Println("PKGBUILD matches the manifest.")
+		}
+		return nil
+	}
+
+	if opts.update && opts.dryRun {
+		return previewPKGBUILD(w, opts.pkgbuildPath, plan.Blobs)
+	}
+	if opts.update {
+		if err := updatePKGBUILD(opts.pkgbuildPath, plan.Blobs, opts.verbose); err != nil {
+			return fmt.Errorf("failed to update PKGBUILD: %w", err)
+		}
+		return nil
+	}
+
+	if opts.relativeURLs {
+		plan.RelativeTo(baseURL)
+	}
+
+	if opts.format == formatGHA {
+		return writeGHAMatrix(w, plan)
+	}
+
+	if opts.format == formatMake {
+		return writeMakefile(w, plan)
+	}
+
+	if opts.format == formatNix {
+		return writeNix(w, plan)
+	}
+
+	if isTableFormat(opts.format) {
+		return writeTable(w, plan, opts.format, opts.tableHeader)
+	}
+
+	if opts.format == formatScript {
+		return writeScript(w, plan, opts.scriptTool)
+	}
+
+	if opts.format == formatSums {
+		return writeChecksums(w, plan, opts.checksumFormat)
+	}
+
+	if opts.jsonByFilename {
+		return writeJSONByFilename(w, plan)
+	}
+
+	if opts.jsonStream {
+		return writeBlobStream(w, plan)
+	}
+
+	if opts.listBlobsJSON || opts.json {
+		if opts.includeHeaders {
+			if err := addResponseHeaders(ctx, client, plan, manifest); err != nil {
+				return err
+			}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if opts.json {
+			return enc.Encode(plan)
+		}
+		return enc.Encode(plan.Blobs)
+	}
+
+	for _, blob := range plan.Blobs {
+		line := blobSource(blob)
+		if blob.IsManifest() {
+			line = blob.Filename + "::" + blob.URL
+		}
+		if opts.withSize {
+			// The size of the manifest is not known up front
+			size := "unknown"
+			if !blob.IsManifest() {
+				size = strconv.FormatInt(blob.Size, 10)
+			}
+			line += "\t" + size
+		}
+		if opts.print0 {
+			fmt.Fprint(w, line+"\x00")
+		} else {
+			fmt.Fprintln(w, line)
+		}
+	}
+	if opts.summary {
+		writePlanSummary(w, plan)
+	}
+	return nil
+}
+
+// flagMode is an option that selects what kind of output is produced
+type flagMode struct {
+	name    string
+	enabled bool
+}
+
+// selectMode returns the name of the enabled mode, or "" if none is, and an error if more than one is
+func selectMode(modes []flagMode) (string, error) {
+	var enabled []string
+	for _, mode := range modes {
+		if mode.enabled {
+			enabled = append(enabled, mode.name)
+		}
+	}
+	switch len(enabled) {
+	case 0:
+		return "", nil
+	case 1:
+		return enabled[0], nil
+	}
+	return "", fmt.Errorf("%s can not be combined", strings.Join(enabled, " and "))
+}
+
+// usage prints the flags along with a few examples
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: ollamaurl [options] model[:tag] ...\n")
+	fmt.Fprintf(os.Stderr, "       ollamaurl [options] config\n\n")
+	fmt.Fprintf(os.Stderr, "Print the URLs needed to download an Ollama model.\n\n")
+	fmt.Fprintf(os.Stderr, "Options:\n")
+	pflag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, "\nExamples:\n")
+	fmt.Fprintf(os.Stderr, "  ollamaurl llama3:8b              print the blob and manifest URLs for llama3:8b\n")
+	fmt.Fprintf(os.Stderr, "  ollamaurl user/model:tag         the same for a model in the namespace of a user\n")
+	fmt.Fprintf(os.Stderr, "  ollamaurl -d --output-dir dl llama3\n")
+	fmt.Fprintf(os.Stderr, "                                   download the blobs and manifest of llama3 into dl\n")
+	fmt.Fprintf(os.Stderr, "  ollamaurl -u mistral:7b          update the source and sha256sums arrays in ./PKGBUILD\n")
+	fmt.Fprintf(os.Stderr, "  ollamaurl --count-by-mediatype gemma:2b\n")
+	fmt.Fprintf(os.Stderr, "                                   summarize the layers of gemma:2b\n")
+	fmt.Fprintf(os.Stderr, "  ollamaurl config                 show the settings in effect and where they came from\n")
+}
+
+func main() {
+	// Define flags with both long and short versions using pflag
+	updateFlag := pflag.BoolP("update-pkgbuild", "u", false, "Update the PKGBUILD with URLs for the given model")
+	pkgbuildFlag := pflag.String("pkgbuild", "PKGBUILD", "Path to the PKGBUILD for --update-pkgbuild and --check-pkgbuild, or to the directory that has it")
+	verboseFlag := pflag.BoolP("verbose", "V", false, "Enable verbose output")
+	versionFlag := pflag.BoolP("version", "v", false, "Show the current version")
+	registryURLs := pflag.StringSliceP("registry", "r", []string{ollamaurl.DefaultRegistry}, "Registry base URL, and mirrors to try in order if it fails, comma separated or repeated (this flag, then $"+registryEnvVar+", then the default)")
+	layerFlag := pflag.StringP("layer", "l", "", "Only use the layer with the given index or digest")
+	downloadFlag := pflag.BoolP("download", "d", false, "Download every blob and the manifest, or with --stdout, stream the selected --layer")
+	stdoutFlag := pflag.Bool("stdout", false, "Write the downloaded blob to stdout instead of a file")
+	ignoreConfigFlag := pflag.Bool("ignore-config", false, "Leave out the config layer, also from the PKGBUILD source array")
+	defaultTagFlag := pflag.String("default-tag", ollamaurl.DefaultTag, "Tag to use when the model name has no tag")
+	defaultNamespaceFlag := pflag.String("default-namespace", "", "Namespace to use when the model name has no namespace (default $"+namespaceEnvVar+" or the library namespace)")
+	libraryNamespaceFlag := pflag.String("library-namespace", ollamaurl.DefaultNamespace, "Namespace of the official models on this registry, which may be empty to leave it out of the path")
+	countFlag := pflag.String("count-by-mediatype", "", "Summarize the blob count and size per media type, as text or json")
+	pflag.Lookup("count-by-mediatype").NoOptDefVal = "text"
+	headOnlyFlag := pflag.Bool("head-only", false, "Report the total size from HEAD requests for every blob, instead of from the manifest")
+	sizesFlag := pflag.Bool("sizes", false, "List the size of every blob from HEAD requests, falling back to the manifest, and the total")
+	ggufFlag := pflag.Bool("gguf", false, "Print the GGUF metadata of the model layer, by only downloading the start of it")
+	ggufBytesFlag := pflag.Int64("gguf-header-size", defaultGGUFHeaderBytes, "Number of bytes to download when reading the GGUF metadata")
+	jsonArrayFlag := pflag.Bool("json-array-per-model", false, "Output one JSON object with the plans for all models and any errors")
+	printRequestsFlag := pflag.Bool("print-requests", false, "Print the manifest and blob requests as curl commands, only fetching the manifests and no blobs")
+	annotationFlag := pflag.StringArray("select-by-annotation", nil, "Only use layers with this annotation, given as key or key=value (can be repeated)")
+	mediaTypeFlag := pflag.StringArray("media-type", nil, "Only use layers with this media type, like "+ollamaurl.ModelMediaType+" (can be repeated)")
+	relativeFlag := pflag.Bool("relative-urls", false, "Print blob paths relative to the registry root instead of full URLs")
+	dryRunFlag := pflag.Bool("dry-run", false, "With --update-pkgbuild, print the new source and sha256sums arrays and what would change, instead of writing the PKGBUILD")
+	checkFlag := pflag.Bool("check-pkgbuild", false, "Check that the source and sha256sums arrays in the PKGBUILD match the current manifest")
+	verifyFlag := pflag.String("verify", "", "Check the downloaded blobs in this directory against their digests")
+	concurrencyFlag := pflag.IntP("concurrency", "c", 4, "Number of models or blobs to work on at the same time")
+	requirePinFlag := pflag.Bool("require-digest-pin", false, "Refuse models that are given by tag instead of by digest, like name@sha256:<digest>")
+	withSizeFlag := pflag.Bool("with-size", false, "Print the size in bytes after each URL, separated by a tab")
+	print0Flag := pflag.BoolP("print0", "0", false, "End each URL with a NUL byte instead of a newline, for xargs -0")
+	clientCertFlag := pflag.String("client-cert", "", "PEM encoded client certificate for registries that require mutual TLS")
+	clientKeyFlag := pflag.String("client-key", "", "PEM encoded private key for --client-cert")
+	listBlobsJSONFlag := pflag.Bool("list-blobs-json", false, "Output only a JSON array with the url, filename, digest, size and media type of each blob")
+	jsonFlag := pflag.Bool("json", false, "Output a JSON object with the model, tag, total size and every blob")
+	pruneFlag := pflag.String("prune", "", "List the blobs in this directory that the given models do not use")
+	forceFlag := pflag.Bool("force", false, "Delete the blobs that --prune lists, instead of only listing them")
+	formatFlag := pflag.String("format", formatText, "Output format: "+strings.Join(outputFormats, ", "))
+	referrersFlag := pflag.Bool("referrers", false, "List artifacts like signatures and SBOMs that refer to the manifest")
+	expectDigestFlag := pflag.String("expect-digest", "", "Fail unless the manifest has this sha256 digest")
+	verifyKeyFlag := pflag.String("verify-key", "", "Fail unless the manifest has a valid cosign signature for this PEM encoded public key")
+	printRefFlag := pflag.Bool("print-ref", false, "Print how each model name was parsed into namespace, repository and tag or digest")
+	infoFlag := pflag.Bool("info", false, "Print the schema version, config and layers of each model, or the decoded manifest with --json")
+	latestDigestFlag := pflag.Bool("latest-digest", false, "Print the digest of the manifest that the tag of each model points to, for pinning it")
+	listTagsFlag := pflag.Bool("list-tags", false, "List the tags of each model, one per line, or as JSON with --json")
+	idFlag := pflag.Bool("id", false, "Print the short ID that \"ollama list\" shows for the model once it is pulled")
+	jsonStreamFlag := pflag.Bool("json-stream-blobs", false, "Write one JSON object per line for each blob of each model, as soon as its manifest is fetched, so with several models in the order they finish")
+	repeatableOrderFlag := pflag.Bool("repeatable-order", false, "Guarantee the same output order on every run, also for lists that come from the registry")
+	jsonByFilenameFlag := pflag.Bool("json-by-filename", false, "Output a JSON object that maps each filename to its url, digest, size and media type")
+	noResumeFlag := pflag.Bool("no-resume", false, "Download blobs from the start, instead of resuming the .part files of interrupted downloads")
+	verifyRetriesFlag := pflag.Int("retry-on-verify-failure", 0, "Download a blob again, up to this many times, if it does not match its digest")
+	quietFlag := pflag.BoolP("quiet", "q", false, "Only print the output itself, without download progress, the list of downloaded files or model headers")
+	progressFlag := pflag.String("progress", progressAuto, "Download progress on stderr: "+strings.Join(progressStyles, ", ")+" (auto is a bar on a terminal and none otherwise)")
+	usernameFlag := pflag.String("username", "", "Username for the first registry and its token endpoint (default $"+usernameEnvVar+")")
+	passwordFlag := pflag.String("password", "", "Password for the first registry and its token endpoint (default $"+passwordEnvVar+")")
+	noNetrcFlag := pflag.Bool("no-netrc", false, "Do not look up credentials for the registry in $NETRC or ~/.netrc")
+	strictFlag := pflag.Bool("strict-media-types", false, "Fail if a layer has a media type that is not one of the known application/vnd.ollama.image.* types")
+	metadataFlag := pflag.String("metadata", "", "Only download the manifest and the config blob of each model, into a directory per model under this one")
+	grandTotalFlag := pflag.Bool("grand-total", false, "End with the combined size of all models, counting shared blobs once")
+	proxyFlag := pflag.String("proxy", "", "Proxy for all requests, like http://proxy:3128 or socks5://localhost:1080 (default $HTTPS_PROXY or $HTTP_PROXY)")
+	bindAddrFlag := pflag.String("bind-addr", "", "Source IP address for connections to the registry, to pick the network interface")
+	insecureFlag := pflag.Bool("insecure", false, "Allow plain HTTP registries and registries with self-signed or otherwise unverified TLS certificates")
+	minTLSFlag := pflag.String("min-tls-version", "1.2", "Refuse registries that do not support at least this TLS version: 1.2 or 1.3")
+	includeHeadersFlag := pflag.Bool("json-include-headers", false, "Include the Content-Type, Content-Length, Docker-Content-Digest and ETag response headers in the JSON output")
+	acceptFlag := pflag.StringSlice("accept", nil, "Comma separated manifest media types for the Accept header (default "+strings.Join(ollamaurl.DefaultAccept, ",")+")")
+	platformFlag := pflag.String("platform", "", "Platform to pick from manifest lists, like linux/arm64 (default "+ollamaurl.HostPlatform().String()+")")
+	userAgentFlag := pflag.String("user-agent", strings.Replace(versionString, " ", "/", 1), "User-Agent header for every request")
+	headerFlag := pflag.StringArray("header", nil, "Extra header for every request, given as \"Key: Value\" (can be repeated)")
+	identityFlag := pflag.Bool("identity-encoding", false, "Send Accept-Encoding: identity for blobs, so that proxies do not compress them")
+	checksumFormatFlag := pflag.String("checksum-format", checksumGNU, "Line style for --format=sha256sum: "+strings.Join(checksumFormats, ", "))
+	scriptFlag := pflag.Bool("script", false, "Output a bash script that downloads every blob and the manifest")
+	scriptToolFlag := pflag.String("script-tool", scriptCurl, "Download tool for --script: "+strings.Join(scriptTools, ", "))
+	timeoutFlag := pflag.Duration("timeout", 30*time.Second, "Time limit for each model, like 2m, except for --download (0 for no limit)")
+	connectTimeoutFlag := pflag.Duration("connect-timeout", 30*time.Second, "Time limit for connecting to the registry, and for the TLS handshake (0 for no limit)")
+	headerTimeoutFlag := pflag.Duration("header-timeout", 30*time.Second, "Time limit for the registry to start answering a request, before the body arrives (0 for no limit)")
+	deadlineFlag := pflag.Duration("deadline", 0, "Overall time limit for everything, including retries, like 10m (0 for no limit)")
+	decompressFlag := pflag.Bool("decompress", false, "Decompress the layers whose media type ends in +gzip while they are downloaded, to <blob>"+decompressedSuffix+" files (the digest is checked on the compressed bytes). +zstd layers are not supported and fail before anything is downloaded")
+	decompressMediaTypesFlag := pflag.StringSlice("decompress-media-types", nil, "Comma separated media types of layers that should be gzip decompressed by --download (the digest is checked on the compressed bytes)")
+	expectLayersFlag := pflag.Int("expect-layers", 0, "Fail unless the manifest has exactly this many layers, not counting the config")
+	retriesFlag := pflag.Int("retries", 3, "Number of times a failed request is retried, for both manifests and blobs")
+	manifestRetriesFlag := pflag.Int("manifest-retries", 3, "Number of times a failed manifest request is retried, instead of --retries")
+	blobRetriesFlag := pflag.Int("blob-retries", 3, "Number of times a failed blob request is retried, instead of --retries")
+	cacheTTLFlag := pflag.Duration("cache-ttl", 10*time.Minute, "How long a manifest that is fetched by tag is kept in the cache, like 1h")
+	noCacheFlag := pflag.Bool("no-cache", false, "Always fetch manifests from the registry, without reading or writing the cache")
+	filenameTemplateFlag := pflag.String("filename-template", "", "Name blobs after this Go template, with .Model, .Tag, .Digest, .ShortDigest, .MediaType and .Index, like '{{.Model}}-{{.Tag}}-{{.ShortDigest}}.bin'")
+	fromFileFlag := pflag.String("from-file", "", "Read model names from this file, one per line, or from stdin if it is -")
+	saveManifestFlag := pflag.Bool("save-manifest", false, "Also save the manifest, exactly as it was received, to manifest.json in --output-dir or the current directory")
+	outFlag := pflag.StringP("out", "O", "", "Write the output to this file instead of stdout, creating its directory if needed")
+	outputDirFlag := pflag.StringP("output-dir", "o", "", "Write the output for each model to its own file in this directory, or with --download, the downloaded files (default the current directory)")
+	completionFlag := pflag.String("completion", "", "Print a completion script for the flags, for "+strings.Join(completionShells, ", "))
+	pflag.CommandLine.MarkHidden("completion")
+
+	pflag.Usage = usage
+	pflag.Parse()
+
+	if *versionFlag {
+		fmt.Println(versionString)
+		return
+	}
+
+	if *completionFlag != "" {
+		if err := writeCompletion(os.Stdout, pflag.CommandLine, *completionFlag); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+
+	fromFile := make(map[string]bool)
+	path, err := configPath()
+	if err == nil {
+		if fromFile, err = loadConfig(pflag.CommandLine, path); err != nil {
+			log.Fatalf("Error reading configuration: %v", err)
+		}
+	}
+	// isSet reports if a flag was given on the command line or in the configuration file
+	isSet := func(name string) bool {
+		return pflag.CommandLine.Changed(name) || fromFile[name]
+	}
+
+	if pflag.NArg() > 0 && pflag.Arg(0) == "config" {
+		if pflag.NArg() > 1 {
+			log.Fatalln("Error: the config subcommand takes no arguments")
+		}
+		writeEffectiveConfig(os.Stdout, pflag.CommandLine, fromFile, path)
+		return
+	}
+
+	// Define the model names (e.g., "tinyllama:latest"), from the arguments and then from --from-file
+	modelNames := pflag.Args()
+	if *fromFileFlag != "" {
+		names, err := readModelFile(*fromFileFlag)
+		if err != nil {
+			log.Fatalf("Error reading model names: %v", err)
+		}
+		if len(names) == 0 {
+			log.Fatalf("Error: there are no model names in %s", cmp.Or(strings.TrimPrefix(*fromFileFlag, "-"), "stdin"))
+		}
+		modelNames = append(modelNames, names...)
+	}
+	if len(modelNames) == 0 {
+		// Without a model there is nothing to do, so show how to give one
+		usage()
+		fmt.Fprintln(os.Stderr, "\nError: a model name is needed, like llama3:8b")
+		os.Exit(2)
+	}
+
+	if *requirePinFlag {
+		for _, modelName := range modelNames {
+			if !ollamaurl.IsPinned(modelName) {
+				repository, _, _ := ollamaurl.SplitTag(modelName)
+				log.Fatalf("Error: %s is not pinned by digest, use %s@sha256:<digest> (required by --require-digest-pin)", modelName, repository)
+			}
+		}
+	}
+
+	if !slices.Contains(outputFormats, *formatFlag) {
+		log.Fatalf("Error: unknown --format '%s', use one of: %s", *formatFlag, strings.Join(outputFormats, ", "))
+	}
+
+	if !slices.Contains(progressStyles, *progressFlag) {
+		log.Fatalf("Error: unknown --progress '%s', use one of: %s", *progressFlag, strings.Join(progressStyles, ", "))
+	}
+
+	if !slices.Contains(checksumFormats, *checksumFormatFlag) {
+		log.Fatalf("Error: unknown --checksum-format '%s', use one of: %s", *checksumFormatFlag, strings.Join(checksumFormats, ", "))
+	}
+	if isSet("checksum-format") && *formatFlag != formatSums {
+		log.Fatalln("Error: --checksum-format is only used together with --format=sha256sum")
+	}
+
+	if !slices.Contains(scriptTools, *scriptToolFlag) {
+		log.Fatalf("Error: unknown --script-tool '%s', use one of: %s", *scriptToolFlag, strings.Join(scriptTools, ", "))
+	}
+	if isSet("script-tool") && !*scriptFlag {
+		log.Fatalln("Error: --script-tool is only used together with --script")
+	}
+
+	if *countFlag != "" && *countFlag != "text" && *countFlag != "json" {
+		log.Fatalf("Error: unknown --count-by-mediatype format '%s', use text or json", *countFlag)
+	}
+
+	// Each of these options selects a different kind of output, so only one can be used at a time
+	mode, err := selectMode([]flagMode{
+		{"--update-pkgbuild", *updateFlag},
+		{"--download", *downloadFlag},
+		{"--count-by-mediatype", *countFlag != ""},
+		{"--head-only", *headOnlyFlag},
+		{"--sizes", *sizesFlag},
+		{"--gguf", *ggufFlag},
+		{"--check-pkgbuild", *checkFlag},
+		{"--verify", *verifyFlag != ""},
+		{"--list-blobs-json", *listBlobsJSONFlag},
+		{"--json", *jsonFlag && !*listTagsFlag && !*infoFlag},
+		{"--json-array-per-model", *jsonArrayFlag},
+		{"--print-requests", *printRequestsFlag},
+		{"--prune", *pruneFlag != ""},
+		{"--format", *formatFlag != formatText},
+		{"--script", *scriptFlag},
+		{"--referrers", *referrersFlag},
+		{"--metadata", *metadataFlag != ""},
+		{"--json-by-filename", *jsonByFilenameFlag},
+		{"--json-stream-blobs", *jsonStreamFlag},
+		{"--id", *idFlag},
+		{"--list-tags", *listTagsFlag},
+		{"--info", *infoFlag},
+		{"--latest-digest", *latestDigestFlag},
+	})
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	if *downloadFlag && *stdoutFlag {
+		if *layerFlag == "" || len(modelNames) > 1 {
+			log.Fatalln("Error: --stdout can only stream a single blob, select one model and one --layer")
+		}
+		// Nothing but the blob itself may be written to stdout
+		*verboseFlag = false
+	} else if *downloadFlag {
+		if *layerFlag != "" {
+			log.Fatalln("Error: --layer can only be downloaded with --stdout, a download to disk gets every blob")
+		}
+		if len(modelNames) > 1 {
+			log.Fatalln("Error: --download can only download a single model, since each one has its own manifest.json")
+		}
+	} else if *stdoutFlag {
+		log.Fatalln("Error: --stdout requires --download")
+	}
+
+	if *layerFlag != "" && mode != "" && mode != "--download" && mode != "--gguf" {
+		log.Fatalf("Error: --layer can not be combined with %s", mode)
+	}
+
+	if *withSizeFlag && mode != "" {
+		log.Fatalf("Error: --with-size can not be combined with %s", mode)
+	}
+
+	if *print0Flag && (mode != "" || *grandTotalFlag) {
+		log.Fatalf("Error: --print0 can not be combined with %s", cmp.Or(mode, "--grand-total"))
+	}
+
+	if *grandTotalFlag && ((mode != "" && mode != "--json-array-per-model") || *layerFlag != "") {
+		log.Fatalf("Error: --grand-total can not be combined with %s", cmp.Or(mode, "--layer"))
+	}
+
+	if *saveManifestFlag {
+		if *downloadFlag && !*stdoutFlag {
+			log.Fatalln("Error: --download already saves the manifest, --save-manifest is not needed")
+		}
+		if *metadataFlag != "" {
+			log.Fatalln("Error: --metadata already saves the manifest, --save-manifest is not needed")
+		}
+		if len(modelNames) > 1 {
+			log.Fatalln("Error: --save-manifest can only be used with a single model, since each one has its own manifest.json")
+		}
+	}
+
+	if isSet("pkgbuild") && !*updateFlag && !*checkFlag {
+		log.Fatalln("Error: --pkgbuild is only used together with --update-pkgbuild or --check-pkgbuild")
+	}
+	if *dryRunFlag && !*updateFlag {
+		log.Fatalln("Error: --dry-run is only used together with --update-pkgbuild")
+	}
+	pkgbuildPath := *pkgbuildFlag
+	if info, err := os.Stat(pkgbuildPath); err == nil && info.IsDir() {
+		pkgbuildPath = filepath.Join(pkgbuildPath, "PKGBUILD")
+	}
+
+	if (*updateFlag || *checkFlag) && len(modelNames) > 1 {
+		log.Fatalf("Error: %s can only be used with a single model", mode)
+	}
+
+	if *ggufFlag && *ggufBytesFlag <= 0 {
+		log.Fatalln("Error: --gguf-header-size must be larger than 0")
+	}
+
+	// --retries covers both, unless one of them is given on its own
+	if !isSet("manifest-retries") {
+		*manifestRetriesFlag = *retriesFlag
+	}
+	if !isSet("blob-retries") {
+		*blobRetriesFlag = *retriesFlag
+	}
+	if *retriesFlag < 0 || *manifestRetriesFlag < 0 || *blobRetriesFlag < 0 {
+		log.Fatalln("Error: the number of retries can not be negative")
+	}
+	if max(*retriesFlag, *manifestRetriesFlag, *blobRetriesFlag) > ollamaurl.MaxRetries {
+		log.Fatalf("Error: the number of retries can be at most %d", ollamaurl.MaxRetries)
+	}
+
+	if *verifyRetriesFlag < 0 {
+		log.Fatalln("Error: --retry-on-verify-failure can not be negative")
+	}
+
+	if *deadlineFlag < 0 {
+		log.Fatalln("Error: --deadline can not be negative")
+	}
+
+	if *cacheTTLFlag <= 0 {
+		log.Fatalln("Error: --cache-ttl must be larger than 0, use --no-cache to turn the cache off")
+	}
+	if *noCacheFlag && isSet("cache-ttl") {
+		log.Fatalln("Error: --cache-ttl can not be combined with --no-cache")
+	}
+
+	if *timeoutFlag < 0 {
+		log.Fatalln("Error: --timeout can not be negative")
+	}
+	if *connectTimeoutFlag < 0 {
+		log.Fatalln("Error: --connect-timeout can not be negative")
+	}
+	if *headerTimeoutFlag < 0 {
+		log.Fatalln("Error: --header-timeout can not be negative")
+	}
+
+	if *concurrencyFlag < 1 {
+		log.Fatalln("Error: --concurrency must be at least 1")
+	}
+
+	if *forceFlag && *pruneFlag == "" {
+		log.Fatalln("Error: --force is only used together with --prune")
+	}
+
+	if *metadataFlag != "" && (*ignoreConfigFlag || *outputDirFlag != "") {
+		log.Fatalln("Error: --metadata can not be combined with --ignore-config or --output-dir")
+	}
+
+	if *relativeFlag && *updateFlag {
+		log.Fatalln("Error: --relative-urls can not be combined with --update-pkgbuild, since makepkg needs full URLs")
+	}
+
+	if *outFlag != "" && *outFlag != "-" {
+		if *outputDirFlag != "" {
+			log.Fatalln("Error: --out can not be combined with --output-dir")
+		}
+		if *updateFlag || *downloadFlag {
+			log.Fatalf("Error: --out can not be combined with %s", mode)
+		}
+	}
+
+	if *outputDirFlag != "" && (*updateFlag || (*downloadFlag && *stdoutFlag) || *jsonArrayFlag || *printRequestsFlag || *pruneFlag != "") {
+		log.Fatalf("Error: --output-dir can not be combined with %s", mode)
+	}
+
+	if *includeHeadersFlag && !*listBlobsJSONFlag && !*jsonFlag && !*jsonArrayFlag {
+		log.Fatalln("Error: --json-include-headers is only used together with --json, --list-blobs-json or --json-array-per-model")
+	}
+
+	if *noResumeFlag && (!*downloadFlag || *stdoutFlag) {
+		log.Fatalln("Error: --no-resume is only used together with --download to a directory")
+	}
+
+	if isSet("progress") && !*downloadFlag {
+		log.Fatalln("Error: --progress is only used together with --download")
+	}
+	if *quietFlag {
+		if *verboseFlag {
+			log.Fatalln("Error: --quiet and --verbose can not be combined")
+		}
+		if isSet("progress") {
+			log.Fatalln("Error: --progress can not be combined with --quiet")
+		}
+		*progressFlag = progressNone
+	}
+
+	if *decompressFlag && !*downloadFlag {
+		log.Fatalln("Error: --decompress is only used together with --download")
+	}
+	if len(*decompressMediaTypesFlag) > 0 && !*downloadFlag {
+		log.Fatalln("Error: --decompress-media-types is only used together with --download")
+	}
+
+	if *libraryNamespaceFlag != "" {
+		if err := ollamaurl.ValidateRepositoryComponent(*libraryNamespaceFlag, "library namespace"); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+
+	if *expectDigestFlag != "" {
+		if err := ollamaurl.ValidateDigest(*expectDigestFlag); err != nil {
+			log.Fatalf("Error: --expect-digest: %v", err)
+		}
+	}
+
+	expectLayers := -1
+	if isSet("expect-layers") {
+		if *expectLayersFlag < 0 {
+			log.Fatalln("Error: --expect-layers can not be negative")
+		}
+		expectLayers = *expectLayersFlag
+	}
+
+	var verifyKey crypto.PublicKey
+	if *verifyKeyFlag != "" {
+		if verifyKey, err = ollamaurl.LoadPublicKey(*verifyKeyFlag); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+
+	annotations, err := parseAnnotationSelectors(*annotationFlag)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Parse the registry URL
+	if env := os.Getenv(registryEnvVar); env != "" && !isSet("registry") {
+		*registryURLs = strings.Split(env, ",")
+	}
+	var registries []*url.URL
+	for _, registryURL := range *registryURLs {
+		u, err := url.Parse(strings.TrimSpace(registryURL))
+		if err != nil {
+			log.Fatalf("Error parsing registry URL '%s': %v", registryURL, err)
+		}
+		if u.Scheme == "http" && !*insecureFlag {
+			log.Fatalf("Error: %s is a plain HTTP registry, use --insecure to allow it", u)
+		}
+		registries = append(registries, u)
+	}
+	if len(registries) == 0 {
+		log.Fatalln("Error: --registry can not be empty")
+	}
+	if *insecureFlag && !*quietFlag {
+		fmt.Fprintln(os.Stderr, "Warning: --insecure is given, so plain HTTP registries are allowed and TLS certificates are not verified")
+	}
+	baseURL := registries[0]
+
+	transport, err := newTransport(transportOptions{
+		clientCert:    *clientCertFlag,
+		clientKey:     *clientKeyFlag,
+		minTLSVersion: *minTLSFlag,
+		bindAddr:      *bindAddrFlag,
+		proxy:         *proxyFlag,
+		insecure:      *insecureFlag,
+
+		connectTimeout: *connectTimeoutFlag,
+		headerTimeout:  *headerTimeoutFlag,
+	})
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// There is no overall timeout per request, which would cut off the download of a large blob.
+	// The transport has timeouts for connecting and for the response headers, and the context
+	// of each model has the --timeout.
+	httpClient := &http.Client{
+		Transport: transport,
+	}
+
+	client := ollamaurl.NewClient(baseURL, httpClient)
+	client.SetMirrors(registries[1:]...)
+	client.SetVerbose(*verboseFlag)
+	client.SetRetries(*manifestRetriesFlag, *blobRetriesFlag)
+	client.SetIdentityEncoding(*identityFlag)
+	client.SetAccept(*acceptFlag...)
+	if !*noCacheFlag {
+		if dir, err := manifestCacheDir(); err == nil {
+			client.SetCache(ollamaurl.NewFileCache(dir, *cacheTTLFlag))
+		} else if *verboseFlag {
+			fmt.Printf("Not caching manifests: %v\n", err)
+		}
+	}
+	if *userAgentFlag != "" {
+		client.SetHeader("User-Agent", *userAgentFlag)
+	}
+	for _, arg := range *headerFlag {
+		key, value, err := parseRequestHeader(arg)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		client.SetHeader(key, value)
+	}
+	if *platformFlag != "" {
+		platform, err := ollamaurl.ParsePlatform(*platformFlag)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		client.SetPlatform(platform)
+	}
+
+	// --username and --password are for the first registry. Every registry host can have its own
+	// .netrc entry, and the default entry is only used for the first registry.
+	username := cmp.Or(*usernameFlag, os.Getenv(usernameEnvVar))
+	if username != "" {
+		client.SetBasicAuth(username, cmp.Or(*passwordFlag, os.Getenv(passwordEnvVar)))
+	}
+	if !*noNetrcFlag {
+		for i, registry := range registries {
+			if i == 0 && username != "" {
+				continue
+			}
+			login, password, found, err := netrcCredentials(netrcPath(), registry.Hostname(), i == 0)
+			if err != nil {
+				log.Fatalf("Error reading .netrc: %v", err)
+			}
+			if found {
+				if *verboseFlag {
+					fmt.Printf("Using the .netrc credentials for %s\n", registry.Hostname())
+				}
+				client.SetCredentials(registry.Host, login, password)
+			}
+		}
+	}
+
+	opts := options{
+		verbose:      *verboseFlag,
+		update:       *updateFlag,
+		dryRun:       *dryRunFlag,
+		layer:        *layerFlag,
+		download:     *downloadFlag,
+		ignoreConfig: *ignoreConfigFlag,
+		defaults: ollamaurl.ModelDefaults{
+			Namespace: resolveDefaultNamespace(*defaultNamespaceFlag, *libraryNamespaceFlag),
+			Tag:       *defaultTagFlag,
+		},
+		countFormat:   *countFlag,
+		headOnly:      *headOnlyFlag,
+		sizes:         *sizesFlag,
+		gguf:          *ggufFlag,
+		ggufBytes:     *ggufBytesFlag,
+		annotations:   annotations,
+		mediaTypes:    *mediaTypeFlag,
+		relativeURLs:  *relativeFlag,
+		check:         *checkFlag,
+		verifyDir:     *verifyFlag,
+		concurrency:   *concurrencyFlag,
+		withSize:      *withSizeFlag,
+		print0:        *print0Flag,
+		listBlobsJSON: *listBlobsJSONFlag,
+		json:          *jsonFlag,
+		format:        *formatFlag,
+		referrers:     *referrersFlag,
+		expectDigest:  *expectDigestFlag,
+		verifyKey:     verifyKey,
+		printRef:      *printRefFlag,
+		expectLayers:  expectLayers,
+
+		decompress:           *decompressFlag,
+		decompressMediaTypes: *decompressMediaTypesFlag,
+		checksumFormat:       *checksumFormatFlag,
+		scriptTool:           *scriptToolFlag,
+		includeHeaders:       *includeHeadersFlag,
+		strictMediaTypes:     *strictFlag,
+		progress:             resolveProgressStyle(*progressFlag),
+		verifyRetries:        *verifyRetriesFlag,
+		noResume:             *noResumeFlag,
+		quiet:                *quietFlag,
+		summary:              !*quietFlag && !*print0Flag && isTerminal(os.Stdout) && *outputDirFlag == "" && (*outFlag == "" || *outFlag == "-"),
+		timeout:              *timeoutFlag,
+		pkgbuildPath:         pkgbuildPath,
+		jsonByFilename:       *jsonByFilenameFlag,
+		repeatableOrder:      *repeatableOrderFlag,
+		jsonStream:           *jsonStreamFlag,
+		printID:              *idFlag,
+		listTags:             *listTagsFlag,
+		info:                 *infoFlag,
+		latestDigest:         *latestDigestFlag,
+	}
+	if *filenameTemplateFlag != "" {
+		if opts.filenameTemplate, err = parseFilenameTemplate(*filenameTemplateFlag); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+
+	// Check every model name before anything is sent, so that a typo in the last one is found right away
+	for _, modelName := range modelNames {
+		if err := ollamaurl.ValidateModelName(modelName, opts.defaults); err != nil {
+			log.Fatalf("Error: %s: %v", modelName, err)
+		}
+	}
+
+	if *scriptFlag {
+		opts.format = formatScript
+	}
+	if *grandTotalFlag {
+		opts.total = &GrandTotal{}
+	}
+	if *metadataFlag != "" {
+		opts.metadataDirs = newOutputFileNamer(*metadataFlag, "")
+	}
+
+	if *saveManifestFlag {
+		opts.saveManifestDir = cmp.Or(*outputDirFlag, ".")
+		if err := os.MkdirAll(opts.saveManifestDir, 0755); err != nil {
+			log.Fatalf("Error creating output directory: %v", err)
+		}
+	}
+
+	// With --download, the output directory is where the blobs go, instead of the output files
+	var outputFiles *outputFileNamer
+	if *downloadFlag && !*stdoutFlag {
+		opts.downloadDir = cmp.Or(*outputDirFlag, ".")
+	} else if *outputDirFlag != "" {
+		if err := os.MkdirAll(*outputDirFlag, 0755); err != nil {
+			log.Fatalf("Error creating output directory: %v", err)
+		}
+		extension := ".txt"
+		if *countFlag == "json" || *listBlobsJSONFlag || *jsonFlag || *jsonByFilenameFlag || *formatFlag == formatGHA {
+			extension = ".json"
+		} else if *jsonStreamFlag {
+			extension = ".jsonl"
+		} else if *formatFlag == formatMake {
+			extension = ".mk"
+		} else if *formatFlag == formatNix {
+			extension = ".nix"
+		} else if isTableFormat(*formatFlag) {
+			extension = "." + *formatFlag
+		} else if *scriptFlag {
+			extension = ".sh"
+		}
+		outputFiles = newOutputFileNamer(*outputDirFlag, extension)
+	}
+
+	// With --out, the output goes to a file instead of stdout
+	var out io.Writer = os.Stdout
+	if *outFlag != "" && *outFlag != "-" {
+		f, err := createOutputFile(*outFlag)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			if *verboseFlag {
+				fmt.Printf("Wrote %s\n", *outFlag)
+			}
+		}()
+		out = f
+	}
+
+	// The overall deadline caps everything below, including retries
+	ctx := context.Background()
+	if *deadlineFlag > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, *deadlineFlag, fmt.Errorf("the --deadline of %s was exceeded", *deadlineFlag))
+		defer cancel()
+	}
+
+	if *pruneFlag != "" {
+		if err := pruneBlobs(ctx, out, client, *pruneFlag, modelNames, opts, *forceFlag); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+
+	if *printRequestsFlag {
+		if err := writeRequestScript(ctx, out, client, modelNames, opts); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+
+	if *jsonArrayFlag {
+		if !writeBatchJSON(ctx, out, client, modelNames, opts) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *jsonFlag && !*listTagsFlag && !*infoFlag && len(modelNames) > 1 && outputFiles == nil {
+		if !writeJSONByModel(ctx, out, client, modelNames, opts) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// The plain list of URLs gets a header line per model when there are several
+	headers := (mode == "" || mode == "--list-tags" || mode == "--info" || mode == "--latest-digest") && len(modelNames) > 1 && outputFiles == nil && !*quietFlag && !*print0Flag
+
+	// The rows of several models share a single header row, unless each one goes to its own file
+	if isTableFormat(opts.format) && len(modelNames) > 1 && outputFiles == nil {
+		if err := writeTableHeader(out, opts.format); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	} else {
+		opts.tableHeader = true
+	}
+
+	// The output filenames are handed out up front, so that they do not depend on which model finishes first
+	var filenames []string
+	if outputFiles != nil {
+		filenames = outputFiles.assign(modelNames, opts.defaults)
+	}
+
+	// With several workers, the models are processed in the background and their
+	// output is buffered, so that it can be written in the order the models were given.
+	// --json-stream-blobs is the exception, its lines are written as soon as they are
+	// ready, in the order the manifests arrive, and every line names its model.
+	sequential := len(modelNames) == 1 || opts.modelConcurrency() == 1
+	var stream *lockedWriter
+	if !sequential && opts.jsonStream && outputFiles == nil {
+		stream = &lockedWriter{w: out}
+	}
+	outputs := make([]bytes.Buffer, len(modelNames))
+	errs := make([]error, len(modelNames))
+
+	// A model that fails fatally, like with a registry that can not be reached, stops the others
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+	process := func(ctx context.Context, i int) {
+		if ctx.Err() != nil {
+			errs[i] = context.Cause(ctx)
+			return
+		}
+		w := out
+		if stream != nil {
+			w = stream
+		} else if !sequential {
+			w = &outputs[i]
+		}
+		// Retrieve the manifest for the model with a context timeout
+		modelCtx, cancel := opts.modelContext(ctx)
+		defer cancel()
+		if outputFiles == nil {
+			errs[i] = processModel(modelCtx, client, modelNames[i], opts, w)
+		} else {
+			errs[i] = writeModelOutput(modelCtx, client, modelNames[i], opts, filenames[i])
+		}
+		stopOnFatal(stop, modelNames[i], errs[i])
+	}
+	var done []chan struct{}
+	if !sequential {
+		done = startModels(ctx, modelNames, opts.modelConcurrency(), process)
+	}
+
+	// A failing model is reported and the others are still processed
+	failed := 0
+	for i, modelName := range modelNames {
+		if headers {
+			if i > 0 {
+				fmt.Fprintln(out)
+			}
+			fmt.Fprintf(out, "# %s\n", modelName)
+		}
+		if sequential {
+			process(ctx, i)
+		} else {
+			<-done[i]
+			if stream == nil {
+				out.Write(outputs[i].Bytes())
+			}
+		}
+
+		err := errs[i]
+		if err != nil && ctx.Err() != nil {
+			log.Fatalln(stoppedError(context.Cause(ctx), modelName, err, modelNames[i:]))
+		}
+		if err != nil {
+			log.Printf("Error: %s: %v", modelName, err)
+			failed++
+		}
+	}
+
+	if opts.total != nil {
+		opts.total.write(out)
+	}
+
+	if failed > 0 {
+		if len(modelNames) > 1 {
+			log.Printf("Error: %d of %d models failed", failed, len(modelNames))
+		}
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+// writeFileAtomic writes a file by way of a temporary file in the same directory,
+// so that an interrupted download never leaves a partial file behind
+func writeFileAtomic(filename string, write func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	// CreateTemp uses 0600, but these are not secret
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// writeManifestFile saves the manifest exactly as it was received, so that its digest stays the same,
+// to manifest.json in dir, or to a file named by the digest if the model is pinned
+func writeManifestFile(dir string, ref ollamaurl.ModelRef, manifest *ollamaurl.Manifest) (string, error) {
+	manifestPath := filepath.Join(dir, ref.ManifestFilename())
+	err := writeFileAtomic(manifestPath, func(f io.Writer) error {
+		_, err := f.Write(manifest.Raw)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("writing manifest: %w", err)
+	}
+	return manifestPath, nil
+}
+
+// writeMetadata saves the manifest and the config blob of a model, which describe the model
+// without the large layers, to a directory of its own. The written paths are listed on w.
+func writeMetadata(ctx context.Context, client ollamaurl.Registry, ref ollamaurl.ModelRef, manifest *ollamaurl.Manifest, opts options, w io.Writer) error {
+	dir := opts.metadataDirs.next(ref.Namespace, ref.Repository, ref.Reference())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	manifestPath, err := writeManifestFile(dir, ref, manifest)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, manifestPath)
+
+	if manifest.Config.Digest == "" {
+		return nil
+	}
+	configPath := filepath.Join(dir, ollamaurl.CreateFilename(manifest.Config.Digest))
+	err = retryOnVerifyFailure(opts.verifyRetries, func() error {
+		return writeFileAtomic(configPath, func(f io.Writer) error {
+			_, err := ollamaurl.DownloadBlob(ctx, client, ref.Path(), manifest.Config.Digest, f)
+			return err
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("downloading config blob: %w", err)
+	}
+	fmt.Fprintln(w, configPath)
+	return nil
+}
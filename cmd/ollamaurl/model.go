@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+// namespaceEnvVar can set the namespace for model names that do not have one
+const namespaceEnvVar = "OLLAMA_NAMESPACE"
+
+// printRef shows how a model name was parsed, on stderr so that it does not mix with the output
+func printRef(name string, ref ollamaurl.ModelRef) {
+	fmt.Fprintf(os.Stderr, "%s: namespace=%s repository=%s", name, ref.Namespace, ref.Repository)
+	if ref.Digest != "" {
+		fmt.Fprintf(os.Stderr, " digest=%s\n", ref.Digest)
+	} else {
+		fmt.Fprintf(os.Stderr, " tag=%s\n", ref.Tag)
+	}
+}
+
+// resolveDefaultNamespace decides which namespace to use for model names without one.
+// The precedence is: the --default-namespace flag (or the configuration file),
+// then the OLLAMA_NAMESPACE environment variable, then the library namespace,
+// which is "library" unless --library-namespace says otherwise. The library namespace
+// may be empty, for registries where official models have no namespace at all.
+// A namespace given in the model name itself always wins over all of these.
+func resolveDefaultNamespace(flagValue, libraryNamespace string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if env := os.Getenv(namespaceEnvVar); env != "" {
+		return env
+	}
+	return libraryNamespace
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+func TestNamespacePrecedence(t *testing.T) {
+	tests := []struct {
+		name             string
+		model            string
+		flag             string // --default-namespace
+		env              string // $OLLAMA_NAMESPACE
+		libraryNamespace string // --library-namespace
+		want             string // the repository path
+	}{
+		{"library default", "tinyllama", "", "", ollamaurl.DefaultNamespace, "library/tinyllama"},
+		{"library namespace flag", "tinyllama", "", "", "official", "official/tinyllama"},
+		{"empty library namespace", "tinyllama", "", "", "", "tinyllama"},
+		{"env", "tinyllama", "", "team", ollamaurl.DefaultNamespace, "team/tinyllama"},
+		{"env over library namespace flag", "tinyllama", "", "team", "official", "team/tinyllama"},
+		{"flag", "tinyllama", "user", "", ollamaurl.DefaultNamespace, "user/tinyllama"},
+		{"flag over env", "tinyllama", "user", "team", ollamaurl.DefaultNamespace, "user/tinyllama"},
+		{"flag over env and library namespace flag", "tinyllama", "user", "team", "official", "user/tinyllama"},
+		{"explicit", "other/tinyllama", "", "", ollamaurl.DefaultNamespace, "other/tinyllama"},
+		{"explicit over env", "other/tinyllama", "", "team", ollamaurl.DefaultNamespace, "other/tinyllama"},
+		{"explicit over flag", "other/tinyllama", "user", "", ollamaurl.DefaultNamespace, "other/tinyllama"},
+		{"explicit over everything", "other/tinyllama:1b", "user", "team", "official", "other/tinyllama"},
+		{"explicit library", "library/tinyllama", "user", "team", "", "library/tinyllama"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(namespaceEnvVar, tt.env)
+			ref, err := ollamaurl.ParseModelPath(tt.model, ollamaurl.ModelDefaults{
+				Namespace: resolveDefaultNamespace(tt.flag, tt.libraryNamespace),
+				Tag:       ollamaurl.DefaultTag,
+			})
+			if err != nil {
+				t.Fatalf("ParseModelPath(%q): %v", tt.model, err)
+			}
+			if got := ref.Path(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamespacePrecedenceInvalid(t *testing.T) {
+	// An invalid namespace from the environment is reported, unless something wins over it
+	t.Setenv(namespaceEnvVar, "Not Valid")
+	defaults := ollamaurl.ModelDefaults{
+		Namespace: resolveDefaultNamespace("", ollamaurl.DefaultNamespace),
+		Tag:       ollamaurl.DefaultTag,
+	}
+	if _, err := ollamaurl.ParseModelPath("tinyllama", defaults); err == nil {
+		t.Error("expected an error for an invalid namespace from the environment")
+	}
+	if _, err := ollamaurl.ParseModelPath("user/tinyllama", defaults); err != nil {
+		t.Errorf("an explicit namespace should win over the environment: %v", err)
+	}
+	defaults.Namespace = resolveDefaultNamespace("user", ollamaurl.DefaultNamespace)
+	if _, err := ollamaurl.ParseModelPath("tinyllama", defaults); err != nil {
+		t.Errorf("--default-namespace should win over the environment: %v", err)
+	}
+}
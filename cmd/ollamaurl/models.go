@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+// modelConcurrency is the number of models to work on at the same time. Verbose messages go
+// straight to stdout and a PKGBUILD can only be updated by one model at a time, so then it is one.
+func (o options) modelConcurrency() int {
+	if o.verbose || o.update {
+		return 1
+	}
+	return o.concurrency
+}
+
+// modelContext returns the context for processing a single model, which is cancelled after --timeout.
+// Downloads have no such limit, since a large blob on a slow connection can take hours. They are
+// still limited by --deadline, and by --connect-timeout and --header-timeout for each request.
+func (o options) modelContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.timeout <= 0 || o.download {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, o.timeout)
+}
+
+// startModels calls fn for every model on up to concurrency workers. It returns a channel per
+// model that is closed when fn has returned for it, so that the results can be used in the
+// order the models were given, as soon as they are ready.
+func startModels(ctx context.Context, modelNames []string, concurrency int, fn func(ctx context.Context, i int)) []chan struct{} {
+	done := make([]chan struct{}, len(modelNames))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	jobs := make(chan int)
+	for range max(1, min(concurrency, len(modelNames))) {
+		go func() {
+			for i := range jobs {
+				fn(ctx, i)
+				close(done[i])
+			}
+		}()
+	}
+	go func() {
+		for i := range modelNames {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+	return done
+}
+
+// isFatal reports if a model failed in a way that the other models would fail too, like a
+// registry that can not be reached or that refuses the credentials. A model that is not found,
+// or that is not what was expected, is not fatal, and neither is the --timeout of one model.
+// With mirrors, the error is only fatal if every registry failed like that.
+func isFatal(err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return false
+	case interface{ Unwrap() []error }:
+		errs := e.Unwrap()
+		for _, err := range errs {
+			if !isFatal(err) {
+				return false
+			}
+		}
+		return len(errs) > 0
+	case *url.Error:
+		return !errors.Is(e.Err, context.Canceled) && !errors.Is(e.Err, context.DeadlineExceeded)
+	}
+	if err == ollamaurl.ErrUnauthorized {
+		return true
+	}
+	return isFatal(errors.Unwrap(err))
+}
+
+// fatalError is the cause of a run that was stopped by a model that failed fatally
+type fatalError struct {
+	model string
+	err   error
+}
+
+func (e *fatalError) Error() string {
+	return e.model + ": " + e.err.Error()
+}
+
+func (e *fatalError) Unwrap() error {
+	return e.err
+}
+
+// stopOnFatal cancels the work on the other models if a model failed fatally, with the
+// error as the cause
+func stopOnFatal(stop context.CancelCauseFunc, modelName string, err error) {
+	if isFatal(err) {
+		stop(&fatalError{model: modelName, err: err})
+	}
+}
+
+// stoppedError describes why a run was stopped, by --deadline or by a model that failed fatally,
+// and which models did not finish. The first of them failed with err, which is only shown if it
+// says more than the cause, like which blobs of a download did not finish.
+func stoppedError(cause error, modelName string, err error, unfinished []string) string {
+	var fatal *fatalError
+	if errors.As(cause, &fatal) {
+		// The model that stopped the others did finish, and the cause already says how
+		unfinished = slices.DeleteFunc(slices.Clone(unfinished), func(name string) bool {
+			return name == fatal.model
+		})
+	}
+	msg := fmt.Sprintf("Error: %v", cause)
+	if len(unfinished) > 0 {
+		msg += ", unfinished models: " + strings.Join(unfinished, ", ")
+	}
+	if !errors.Is(err, cause) && !errors.Is(cause, err) {
+		msg += fmt.Sprintf("\n%s: %v", modelName, err)
+	}
+	return msg
+}
+
+// waitModels waits until every model has been processed
+func waitModels(done []chan struct{}) {
+	for _, ch := range done {
+		<-ch
+	}
+}
+
+// readModelNames reads model names for --from-file, one per line. Blank lines are skipped,
+// and everything after a '#' is a comment.
+func readModelNames(r io.Reader) ([]string, error) {
+	var modelNames []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			modelNames = append(modelNames, line)
+		}
+	}
+	return modelNames, scanner.Err()
+}
+
+// readModelFile reads the model names in a file, or on stdin if the filename is "-"
+func readModelFile(filename string) ([]string, error) {
+	if filename == "-" {
+		return readModelNames(os.Stdin)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readModelNames(f)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+func TestIsFatal(t *testing.T) {
+	refused := &url.Error{Op: "Get", URL: "https://registry.test/v2/", Err: errors.New("connection refused")}
+	timedOut := &url.Error{Op: "Get", URL: "https://registry.test/v2/", Err: context.DeadlineExceeded}
+	notFound := fmt.Errorf("%w: library/other:latest", ollamaurl.ErrModelNotFound)
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"no error", nil, false},
+		{"not found", fmt.Errorf("retrieving manifest: %w", notFound), false},
+		{"unexpected digest", errors.New("the manifest digest is sha256:1, but sha256:2 was expected"), false},
+		{"unreachable", fmt.Errorf("retrieving manifest: performing HTTP request: %w", refused), true},
+		{"timeout of the model", fmt.Errorf("retrieving manifest: %w", timedOut), false},
+		{"unauthorized", fmt.Errorf("retrieving manifest: %w: failed to fetch token", ollamaurl.ErrUnauthorized), true},
+		{"every mirror unreachable", errors.Join(refused, fmt.Errorf("mirror: %w", refused)), true},
+		{"one mirror unreachable", errors.Join(refused, fmt.Errorf("mirror: %w", notFound)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isFatal(tt.err); got != tt.want {
+				t.Errorf("isFatal(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoppedError(t *testing.T) {
+	failure := errors.New("connection refused")
+	cause := &fatalError{model: "b", err: failure}
+	got := stoppedError(cause, "a", cause, []string{"a", "b", "c"})
+	if want := "Error: b: connection refused, unfinished models: a, c"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	got = stoppedError(cause, "b", failure, []string{"b"})
+	if want := "Error: b: connection refused"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	deadline := errors.New("the --deadline of 1s was exceeded")
+	got = stoppedError(deadline, "a", errors.New("2 blobs did not finish"), []string{"a", "b"})
+	if want := "Error: the --deadline of 1s was exceeded, unfinished models: a, b\na: 2 blobs did not finish"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// usernameEnvVar and passwordEnvVar can give the credentials for the registry instead of the flags
+const (
+	usernameEnvVar = "OLLAMAURL_USERNAME"
+	passwordEnvVar = "OLLAMAURL_PASSWORD"
+)
+
+// netrcEntry is a "machine" or "default" entry in a .netrc file
+type netrcEntry struct {
+	machine  string // empty for the default entry
+	login    string
+	password string
+}
+
+// netrcPath returns $NETRC, or ~/.netrc
+func netrcPath() string {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// netrcTokens splits a .netrc file into tokens, leaving out macro definitions,
+// which run from "macdef" until the next empty line
+func netrcTokens(data string) []string {
+	var tokens []string
+	inMacro := false
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		fields := strings.Fields(line)
+		for i, field := range fields {
+			if field == "macdef" {
+				fields = fields[:i]
+				inMacro = true
+				break
+			}
+		}
+		tokens = append(tokens, fields...)
+	}
+	return tokens
+}
+
+// parseNetrc returns the entries of a .netrc file, in order
+func parseNetrc(data string) []netrcEntry {
+	var entries []netrcEntry
+	tokens := netrcTokens(data)
+	for i := 0; i < len(tokens); i++ {
+		value := ""
+		if i+1 < len(tokens) {
+			value = tokens[i+1]
+		}
+		switch tokens[i] {
+		case "machine":
+			entries = append(entries, netrcEntry{machine: value})
+			i++
+		case "default":
+			entries = append(entries, netrcEntry{})
+		case "login", "password", "account":
+			if len(entries) > 0 {
+				entry := &entries[len(entries)-1]
+				switch tokens[i] {
+				case "login":
+					entry.login = value
+				case "password":
+					entry.password = value
+				}
+			}
+			i++
+		}
+	}
+	return entries
+}
+
+// netrcCredentials looks up the login and password for host in the .netrc file at path.
+// An entry for the host wins over the default entry, which is only used if useDefault is true.
+// A missing file is not an error.
+func netrcCredentials(path, host string, useDefault bool) (login, password string, found bool, err error) {
+	if path == "" {
+		return "", "", false, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", "", false, nil
+	} else if err != nil {
+		return "", "", false, err
+	}
+	var fallback *netrcEntry
+	entries := parseNetrc(string(data))
+	for i, entry := range entries {
+		if entry.machine == host {
+			return entry.login, entry.password, true, nil
+		}
+		if entry.machine == "" && useDefault && fallback == nil {
+			fallback = &entries[i]
+		}
+	}
+	if fallback != nil {
+		return fallback.login, fallback.password, true, nil
+	}
+	return "", "", false, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// outputFileNamer hands out one output filename per model, in the order the models were given
+type outputFileNamer struct {
+	dir       string
+	extension string
+	used      map[string]bool
+	mu        sync.Mutex
+}
+
+func newOutputFileNamer(dir, extension string) *outputFileNamer {
+	return &outputFileNamer{
+		dir:       dir,
+		extension: extension,
+		used:      make(map[string]bool),
+	}
+}
+
+// next returns a path like DIR/library-tinyllama-latest.txt. If two models end up with the
+// same name after sanitizing, the later one gets a "-2", "-3" and so on suffix.
+func (n *outputFileNamer) next(namespace, repository, tag string) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	base := sanitizeFilename(strings.Join([]string{namespace, repository, tag}, "-"))
+	name := base
+	for i := 2; n.used[name]; i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	n.used[name] = true
+	return filepath.Join(n.dir, name+n.extension)
+}
+
+// assign returns the output filename for each model. The filename is empty for a model
+// name that can not be parsed, which writeModelOutput then reports.
+func (n *outputFileNamer) assign(modelNames []string, defaults ollamaurl.ModelDefaults) []string {
+	filenames := make([]string, len(modelNames))
+	for i, modelName := range modelNames {
+		if ref, err := ollamaurl.ParseModelPath(modelName, defaults); err == nil {
+			filenames[i] = n.next(ref.Namespace, ref.Repository, ref.Reference())
+		}
+	}
+	return filenames
+}
+
+// sanitizeFilename replaces everything except letters, digits, '.', '_' and '-' with '-'
+func sanitizeFilename(s string) string {
+	s = unsafeFilenameChars.ReplaceAllString(s, "-")
+	if s = strings.Trim(s, ".-"); s == "" {
+		s = "model"
+	}
+	return s
+}
+
+// createOutputFile creates or truncates the file for --out, and the directories it is in
+func createOutputFile(filename string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(filename)
+}
+
+// writeModelOutput processes a model and writes its output to a file of its own
+func writeModelOutput(ctx context.Context, client ollamaurl.Registry, modelName string, opts options, filename string) error {
+	if _, err := ollamaurl.ParseModelPath(modelName, opts.defaults); err != nil {
+		return fmt.Errorf("parsing model name: %w", err)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := processModel(ctx, client, modelName, opts, f); err != nil {
+		f.Close()
+		os.Remove(filename)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if opts.verbose {
+		fmt.Printf("Wrote %s\n", filename)
+	}
+	return nil
+}
+
+// lockedWriter lets several goroutines write to the same writer, one Write call at a time.
+// Every line of --json-stream-blobs is a single Write, so the lines of different models do
+// not get mixed up.
+type lockedWriter struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// Flush flushes the writer that is written to, if it is buffered
+func (l *lockedWriter) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if f, ok := l.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+// arrayStyle is how the words of a PKGBUILD array are laid out, so that an update can keep
+// the formatting of the maintainer, and running it again changes nothing
+type arrayStyle struct {
+	indent       string // before each word, when there is one word per line
+	quote        string // ', " or nothing
+	oneLine      bool   // all the words on the same line as the parentheses
+	continuation bool   // a backslash at the end of each line that is followed by another word
+}
+
+// defaultArrayStyle is one single quoted word per line, indented by four spaces
+var defaultArrayStyle = arrayStyle{indent: "    ", quote: "'"}
+
+// detectArrayStyle finds the style of an existing array from its body, the text between the
+// parentheses. An empty array gets the default style.
+func detectArrayStyle(body string) arrayStyle {
+	style := defaultArrayStyle
+	words := scanArrayWords(body)
+	if len(words) == 0 {
+		return style
+	}
+	style.quote = arrayQuote(words)
+	if !strings.Contains(body, "\n") {
+		style.oneLine = true
+		return style
+	}
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "\\" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		style.indent = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		style.continuation = strings.HasSuffix(trimmed, "\\")
+		break
+	}
+	return style
+}
+
+// arrayQuote returns the quote of the first word that shows how the array is quoted. A single
+// quoted word that needs quoting says nothing, since quoteWord falls back to single quotes for
+// such words in every style. If there is no other word, the array is single quoted.
+func arrayQuote(words []arrayWord) string {
+	for _, word := range words {
+		if word.quote != "'" || (word.text != "" && !strings.ContainsFunc(word.text, needsQuoting)) {
+			return word.quote
+		}
+	}
+	return "'"
+}
+
+// quoteWord quotes a word for bash in the given style. Words that the style can not hold
+// as they are get single quotes instead.
+func quoteWord(word, quote string) string {
+	switch {
+	case quote == "" && word != "" && !strings.ContainsFunc(word, needsQuoting):
+		return word
+	case quote == `"` && !strings.ContainsAny(word, "$`\\\"!"):
+		return `"` + word + `"`
+	}
+	return "'" + word + "'"
+}
+
+// needsQuoting reports if r has a special meaning to bash in an unquoted word
+func needsQuoting(r rune) bool {
+	return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:@%+=,~", r))
+}
+
+// formatPKGBUILDArray formats a bash array in the given style
+func formatPKGBUILDArray(name string, words []string, style arrayStyle) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = quoteWord(word, style.quote)
+	}
+	if style.oneLine {
+		return name + "=(" + strings.Join(quoted, " ") + ")"
+	}
+	var sb strings.Builder
+	sb.WriteString(name + "=(")
+	for i, word := range quoted {
+		sb.WriteString("\n" + style.indent + word)
+		if style.continuation && i < len(quoted)-1 {
+			sb.WriteString(" \\")
+		}
+	}
+	sb.WriteString("\n)")
+	return sb.String()
+}
+
+// pkgbuildArray is where the named array is in a PKGBUILD, like source or sha256sums. The array
+// has to start a line, after any indentation, so that an array like _source=( does not match.
+// Detecting, parsing and replacing arrays all go through here, so that they agree on which array it is.
+type pkgbuildArray struct {
+	start, end int    // the offsets of name=(...), without the indentation
+	indent     string // the indentation of the line
+	body       string // what is between the parentheses
+}
+
+// findPKGBUILDArray returns the first array with the given name in the PKGBUILD
+func findPKGBUILDArray(content []byte, name string) (pkgbuildArray, bool) {
+	re := regexp.MustCompile(`(?ms)^([ \t]*)(` + regexp.QuoteMeta(name) + `=\((.*?)\))`)
+	match := re.FindSubmatchIndex(content)
+	if match == nil {
+		return pkgbuildArray{}, false
+	}
+	return pkgbuildArray{
+		start:  match[4],
+		end:    match[5],
+		indent: string(content[match[2]:match[3]]),
+		body:   string(content[match[6]:match[7]]),
+	}, true
+}
+
+// replacePKGBUILDArray returns the content with the array replaced by the given text
+func replacePKGBUILDArray(content []byte, array pkgbuildArray, text string) []byte {
+	return append(content[:array.start:array.start], append([]byte(text), content[array.end:]...)...)
+}
+
+// pkgbuildArrayStyle returns the style of the named array in the PKGBUILD, or the default
+// style if there is no such array
+func pkgbuildArrayStyle(content []byte, name string) (arrayStyle, bool) {
+	array, found := findPKGBUILDArray(content, name)
+	if !found {
+		return defaultArrayStyle, false
+	}
+	return detectArrayStyle(array.body), true
+}
+
+// pkgbuildArrays returns the words of the new source and sha256sums arrays, in the same order.
+// A manifest that is fetched by tag can change, so its checksum is only known if the model is pinned.
+func pkgbuildArrays(blobs []ollamaurl.Blob) (sources, sums []string) {
+	for _, blob := range blobs {
+		if blob.IsManifest() {
+			sources = append(sources, blob.Filename+"::"+blob.URL)
+			sums = append(sums, cmp.Or(strings.TrimPrefix(blob.Digest, "sha256:"), "SKIP"))
+		} else {
+			sources = append(sources, blobSource(blob))
+			sums = append(sums, strings.TrimPrefix(blob.Digest, "sha256:"))
+		}
+	}
+	return sources, sums
+}
+
+// updatedPKGBUILD returns the PKGBUILD content with new source and sha256sums arrays
+func updatedPKGBUILD(content []byte, sources, sums []string) ([]byte, error) {
+	sourceArray, found := findPKGBUILDArray(content, "source")
+	if !found {
+		return nil, fmt.Errorf("could not find source array in PKGBUILD")
+	}
+
+	// Keep the style of each array. A new sha256sums array looks like the source array.
+	sourceStyle := detectArrayStyle(sourceArray.body)
+	sumsStyle, found := pkgbuildArrayStyle(content, "sha256sums")
+	if !found {
+		sumsStyle = sourceStyle
+	}
+	newSourceArray := formatPKGBUILDArray("source", sources, sourceStyle)
+	newSumsArray := formatPKGBUILDArray("sha256sums", sums, sumsStyle)
+
+	// Replace the old sha256sums array, or add one right after the source array if there is none.
+	// The source array is found again after that, since the offsets may have changed.
+	if sumsArray, found := findPKGBUILDArray(content, "sha256sums"); found {
+		content = replacePKGBUILDArray(content, sumsArray, newSumsArray)
+		sourceArray, _ = findPKGBUILDArray(content, "source")
+	} else {
+		newSourceArray += "\n" + sourceArray.indent + newSumsArray
+	}
+
+	// Replace the old source array with the new one
+	return replacePKGBUILDArray(content, sourceArray, newSourceArray), nil
+}
+
+// updatePKGBUILD updates the source array in the PKGBUILD with new URLs and filenames,
+// and the sha256sums array with the matching checksums, which are taken from the digests
+func updatePKGBUILD(pkgbuildPath string, blobs []ollamaurl.Blob, verbose bool) error {
+	// Read the existing PKGBUILD
+	content, err := os.ReadFile(pkgbuildPath)
+	if err != nil {
+		return fmt.Errorf("failed to read PKGBUILD: %w", err)
+	}
+
+	sources, sums := pkgbuildArrays(blobs)
+	newContent, err := updatedPKGBUILD(content, sources, sums)
+	if err != nil {
+		return err
+	}
+
+	// Write the updated PKGBUILD back to file
+	err = os.WriteFile(pkgbuildPath, newContent, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write to PKGBUILD: %w", err)
+	}
+
+	if verbose {
+		fmt.Printf("%s successfully updated.\n", pkgbuildPath)
+	}
+	return nil
+}
+
+// previewPKGBUILD is updatePKGBUILD for --dry-run. It writes the new source and sha256sums
+// arrays to w, followed by the entries that would be removed (-) and added (+), and leaves
+// the PKGBUILD as it is.
+func previewPKGBUILD(w io.Writer, pkgbuildPath string, blobs []ollamaurl.Blob) error {
+	content, err := os.ReadFile(pkgbuildPath)
+	if err != nil {
+		return fmt.Errorf("failed to read PKGBUILD: %w", err)
+	}
+	sources, sums := pkgbuildArrays(blobs)
+
+	// The new arrays, as they would be written
+	newContent, err := updatedPKGBUILD(content, sources, sums)
+	if err != nil {
+		return err
+	}
+	sourceStyle, _ := pkgbuildArrayStyle(newContent, "source")
+	sumsStyle, _ := pkgbuildArrayStyle(newContent, "sha256sums")
+	fmt.Fprintln(w, formatPKGBUILDArray("source", sources, sourceStyle))
+	fmt.Fprintln(w, formatPKGBUILDArray("sha256sums", sums, sumsStyle))
+
+	changed := false
+	for _, array := range []struct {
+		name  string
+		words []string
+	}{{"source", sources}, {"sha256sums", sums}} {
+		old, _ := parsePKGBUILDArray(content, array.name)
+		removed, added := wordChanges(old, array.words)
+		for _, word := range removed {
+			fmt.Fprintf(w, "%s: - %s\n", array.name, word)
+		}
+		for _, word := range added {
+			fmt.Fprintf(w, "%s: + %s\n", array.name, word)
+		}
+		changed = changed || len(removed) > 0 || len(added) > 0
+	}
+	if changed {
+		fmt.Fprintf(w, "Would update %s\n", pkgbuildPath)
+	} else {
+		fmt.Fprintf(w, "%s is already up to date\n", pkgbuildPath)
+	}
+	return nil
+}
+
+// wordChanges returns the words of before that are not in after, and the words of after that are not in before
+func wordChanges(before, after []string) (removed, added []string) {
+	for _, word := range before {
+		if !slices.Contains(after, word) {
+			removed = append(removed, word)
+		}
+	}
+	for _, word := range after {
+		if !slices.Contains(before, word) {
+			added = append(added, word)
+		}
+	}
+	return removed, added
+}
+
+var blobDigestPattern = regexp.MustCompile(`/blobs/(sha256:[0-9a-f]{64})`)
+
+// arrayWord is a word of a bash array, and the quote that it starts with, ', " or nothing
+type arrayWord struct {
+	text  string
+	quote string
+}
+
+// scanArrayWords splits the body of a bash array into its words, handling single and
+// double quotes and comments. Variables are kept as they are.
+func scanArrayWords(body string) []arrayWord {
+	var (
+		words   []arrayWord
+		current strings.Builder
+		inWord  bool
+		first   string // the quote that the current word starts with
+		quote   rune
+		comment bool
+	)
+	for _, r := range body {
+		switch {
+		case comment:
+			if r == '\n' {
+				comment = false
+			}
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			if !inWord {
+				first = string(r)
+			}
+			quote = r
+			inWord = true
+		case r == '#' && !inWord:
+			comment = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\\':
+			if inWord {
+				words = append(words, arrayWord{text: current.String(), quote: first})
+				current.Reset()
+				inWord = false
+			}
+		default:
+			if !inWord {
+				first = ""
+			}
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, arrayWord{text: current.String(), quote: first})
+	}
+	return words
+}
+
+// parseArrayWords returns the words of the body of a bash array, without their quotes
+func parseArrayWords(body string) []string {
+	var words []string
+	for _, word := range scanArrayWords(body) {
+		words = append(words, word.text)
+	}
+	return words
+}
+
+// parsePKGBUILDArray returns the words of the named array, like source or sha256sums
+func parsePKGBUILDArray(content []byte, name string) ([]string, bool) {
+	array, found := findPKGBUILDArray(content, name)
+	if !found {
+		return nil, false
+	}
+	return parseArrayWords(array.body), true
+}
+
+// checkPKGBUILD compares the source and sha256sums arrays of the PKGBUILD with the blobs
+// from a freshly fetched manifest, and returns a description of every difference
+func checkPKGBUILD(pkgbuildPath string, blobs []ollamaurl.Blob) ([]string, error) {
+	content, err := os.ReadFile(pkgbuildPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PKGBUILD: %w", err)
+	}
+	sources, found := parsePKGBUILDArray(content, "source")
+	if !found {
+		return nil, fmt.Errorf("could not find source array in PKGBUILD")
+	}
+	sums, found := parsePKGBUILDArray(content, "sha256sums")
+	if !found {
+		return nil, fmt.Errorf("could not find sha256sums array in PKGBUILD")
+	}
+
+	var drift []string
+	if len(sums) != len(sources) {
+		drift = append(drift, fmt.Sprintf("the source array has %d entries, but sha256sums has %d", len(sources), len(sums)))
+	}
+
+	wanted := make(map[string]bool)
+	for _, blob := range blobs {
+		if !blob.IsManifest() {
+			wanted[blob.Digest] = true
+		}
+	}
+
+	present := make(map[string]bool)
+	for i, source := range sources {
+		match := blobDigestPattern.FindStringSubmatch(source)
+		if match == nil {
+			continue
+		}
+		digest := match[1]
+		present[digest] = true
+		if !wanted[digest] {
+			drift = append(drift, fmt.Sprintf("source entry %d is blob %s, which is not in the manifest", i+1, digest))
+		}
+		if i < len(sums) && sums[i] != strings.TrimPrefix(digest, "sha256:") {
+			drift = append(drift, fmt.Sprintf("sha256sums entry %d is %s, but the digest of its source is %s", i+1, sums[i], digest))
+		}
+	}
+	for _, blob := range blobs {
+		if !blob.IsManifest() && !present[blob.Digest] {
+			drift = append(drift, fmt.Sprintf("blob %s from the manifest is missing from the source array", blob.Digest))
+		}
+	}
+	return drift, nil
+}
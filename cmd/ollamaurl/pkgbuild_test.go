@@ -0,0 +1,105 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestUpdatedPKGBUILDIsIdempotent(t *testing.T) {
+	const blobs = "https://registry.test/v2/library/tinyllama/blobs/"
+	sources := []string{
+		"sha256-" + strings.Repeat("1", 64) + "::" + blobs + testDigest("1"),
+		"sha256-" + strings.Repeat("2", 64) + "::" + blobs + testDigest("2"),
+		"manifest.json::https://registry.test/v2/library/tinyllama/manifests/latest",
+	}
+	sums := []string{strings.Repeat("1", 64), strings.Repeat("2", 64), "SKIP"}
+
+	tests := []struct {
+		name     string
+		pkgbuild string
+		want     string // a line that the updated PKGBUILD must have, to show that the style was kept
+	}{
+		{"four spaces", "pkgname=model\nsource=(\n    'old::https://example.com/old'\n)\nsha256sums=(\n    'SKIP'\n)\n", "\n    'SKIP'\n)"},
+		{"two spaces", "source=(\n  'old'\n)\nsha256sums=(\n  'SKIP'\n)\n", "\n  'SKIP'\n)"},
+		{"tabs", "source=(\n\t'old'\n)\nsha256sums=(\n\t'SKIP'\n)\n", "\n\t'SKIP'\n)"},
+		{"double quotes", "source=(\n    \"old\"\n)\nsha256sums=(\n    \"SKIP\"\n)\n", "\n    \"SKIP\"\n)"},
+		{"unquoted", "source=(\n    old\n)\nsha256sums=(\n    SKIP\n)\n", "\n    SKIP\n)"},
+		{"one line", "source=('old')\nsha256sums=('SKIP')\n", "sha256sums=('" + sums[0] + "' '" + sums[1] + "' 'SKIP')"},
+		{"one line unquoted", "source=(old)\nsha256sums=(SKIP)\n", "sha256sums=(" + sums[0] + " " + sums[1] + " SKIP)"},
+		{"line continuations", "source=(\n    'old' \\\n    'older'\n)\nsha256sums=(\n    'SKIP' \\\n    'SKIP'\n)\n", "\n    '" + sums[1] + "' \\\n    'SKIP'\n)"},
+		{"unquoted line continuations", "source=(\n  old \\\n  older\n)\nsha256sums=(\n  SKIP \\\n  SKIP\n)\n", "\n  " + sums[1] + " \\\n  SKIP\n)"},
+		{"no sha256sums", "source=(\n    \"old\"\n)\nbuild() {\n  :\n}\n", "\n    \"SKIP\"\n)"},
+		{"indented arrays", "if true; then\n  source=(\n      'old'\n  )\n  sha256sums=(\n      'SKIP'\n  )\nfi\n", "\n      'SKIP'\n)"},
+		{"comments", "source=(\n    # the blobs\n    'old'\n)\nsha256sums=(\n    'SKIP' # the manifest\n)\n", "\n    'SKIP'\n)"},
+		{"empty arrays", "source=()\nsha256sums=()\n", "\n    'SKIP'\n)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			once, err := updatedPKGBUILD([]byte(tt.pkgbuild), sources, sums)
+			if err != nil {
+				t.Fatal(err)
+			}
+			twice, err := updatedPKGBUILD(once, sources, sums)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(twice) != string(once) {
+				t.Errorf("updating again changed the PKGBUILD\nonce:\n%s\ntwice:\n%s", once, twice)
+			}
+			if !strings.Contains(string(once), tt.want) {
+				t.Errorf("the style was not kept, %q is not in:\n%s", tt.want, once)
+			}
+			for _, array := range []struct {
+				name  string
+				words []string
+			}{{"source", sources}, {"sha256sums", sums}} {
+				if got, _ := parsePKGBUILDArray(once, array.name); !slices.Equal(got, array.words) {
+					t.Errorf("%s is %q, want %q", array.name, got, array.words)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdatedPKGBUILDKeepsQuotesAfterFallback(t *testing.T) {
+	// The first word needs quoting, so it gets single quotes in any style. That should
+	// not make the next update take the array for a single quoted one.
+	sources := []string{"blob::https://registry.test/blob?a=1&b=2", "manifest.json::https://registry.test/manifest"}
+	sums := []string{strings.Repeat("1", 64), "SKIP"}
+	for _, pkgbuild := range []string{
+		"source=(\n    old\n)\nsha256sums=(\n    SKIP\n)\n",
+		"source=(\n    \"old\"\n)\nsha256sums=(\n    \"SKIP\"\n)\n",
+		"source=(old)\nsha256sums=(SKIP)\n",
+	} {
+		once, err := updatedPKGBUILD([]byte(pkgbuild), sources, sums)
+		if err != nil {
+			t.Fatal(err)
+		}
+		twice, err := updatedPKGBUILD(once, sources, sums)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(twice) != string(once) {
+			t.Errorf("updating again changed the PKGBUILD\nonce:\n%s\ntwice:\n%s", once, twice)
+		}
+		if got, _ := parsePKGBUILDArray(once, "source"); !slices.Equal(got, sources) {
+			t.Errorf("source is %q, want %q", got, sources)
+		}
+	}
+}
+
+func TestUpdatedPKGBUILDLeavesOtherArrays(t *testing.T) {
+	pkgbuild := "_source=('keep')\nsource=('old')\nnoextract=('keep')\n"
+	got, err := updatedPKGBUILD([]byte(pkgbuild), []string{"new"}, []string{"SKIP"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "_source=('keep')\nsource=('new')\nsha256sums=('SKIP')\nnoextract=('keep')\n"
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if _, err := updatedPKGBUILD([]byte("_source=('keep')\n"), []string{"new"}, []string{"SKIP"}); err == nil {
+		t.Error("expected an error for a PKGBUILD without a source array")
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Styles for --progress
+const (
+	progressAuto = "auto"
+	progressBar  = "bar"
+	progressJSON = "json"
+	progressNone = "none"
+)
+
+var progressStyles = []string{progressAuto, progressBar, progressJSON, progressNone}
+
+const progressInterval = 500 * time.Millisecond
+
+// resolveProgressStyle turns "auto" into a bar when stderr is a terminal, and no progress otherwise
+func resolveProgressStyle(style string) string {
+	if style != progressAuto {
+		return style
+	}
+	if isTerminal(os.Stderr) {
+		return progressBar
+	}
+	return progressNone
+}
+
+// isTerminal reports if f is a terminal
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// progressUpdate is one line of --progress=json output
+type progressUpdate struct {
+	Blob       string  `json:"blob"`
+	BytesDone  int64   `json:"bytesDone"`
+	BytesTotal int64   `json:"bytesTotal,omitempty"`
+	Rate       float64 `json:"rate"`          // bytes per second
+	ETA        float64 `json:"eta,omitempty"` // seconds
+}
+
+// progressReporter counts the bytes written through it, and reports on them
+// at a regular interval until finish is called
+type progressReporter struct {
+	w     io.Writer
+	out   io.Writer
+	style string
+	blob  string
+	total int64 // 0 if unknown
+	start time.Time
+	done  atomic.Int64
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// startProgress wraps w, and reports on the progress to out in the given style
+func startProgress(w, out io.Writer, style, blob string, total int64) *progressReporter {
+	p := &progressReporter{
+		w:     w,
+		out:   out,
+		style: style,
+		blob:  blob,
+		total: total,
+		start: time.Now(),
+		stop:  make(chan struct{}),
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.report()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+func (p *progressReporter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.done.Add(int64(n))
+	return n, err
+}
+
+// finish stops the reporting, after a last report
+func (p *progressReporter) finish() {
+	close(p.stop)
+	p.wg.Wait()
+	p.report()
+	if p.style == progressBar {
+		fmt.Fprintln(p.out)
+	}
+}
+
+func (p *progressReporter) report() {
+	update := progressUpdate{
+		Blob:       p.blob,
+		BytesDone:  p.done.Load(),
+		BytesTotal: p.total,
+	}
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		update.Rate = float64(update.BytesDone) / elapsed
+	}
+	if p.total > 0 && update.Rate > 0 && update.BytesDone < p.total {
+		update.ETA = float64(p.total-update.BytesDone) / update.Rate
+	}
+
+	if p.style == progressJSON {
+		data, _ := json.Marshal(update)
+		fmt.Fprintf(p.out, "%s\n", data)
+		return
+	}
+	line := fmt.Sprintf("%s %s", shortDigest(p.blob), humanSize(update.BytesDone))
+	if p.total > 0 {
+		line = fmt.Sprintf("%s %3d%% %s / %s", shortDigest(p.blob), update.BytesDone*100/p.total, humanSize(update.BytesDone), humanSize(p.total))
+	}
+	line += fmt.Sprintf(", %s/s", humanSize(int64(update.Rate)))
+	if update.ETA > 0 {
+		line += fmt.Sprintf(", %s left", (time.Duration(update.ETA) * time.Second).Round(time.Second))
+	}
+	// Clear the rest of the previous line
+	fmt.Fprintf(p.out, "\r%s\033[K", line)
+}
+
+// shortDigest shortens a digest to the algorithm and the first 12 hex digits
+func shortDigest(digest string) string {
+	if strings.HasPrefix(digest, "sha256:") && len(digest) > len("sha256:")+12 {
+		return digest[:len("sha256:")+12]
+	}
+	return digest
+}
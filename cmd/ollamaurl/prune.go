@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+var blobFilenamePattern = regexp.MustCompile(`^sha256-[0-9a-f]{64}$`)
+
+// unreferencedBlobs lists the blob files directly in dir, named like sha256-<hex>,
+// that are not among the referenced filenames. Other files and subdirectories are left alone.
+func unreferencedBlobs(dir string, referenced map[string]bool) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var orphans []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !blobFilenamePattern.MatchString(name) || referenced[name] {
+			continue
+		}
+		orphans = append(orphans, name)
+	}
+	return orphans, nil
+}
+
+// pruneBlobs lists the blobs in dir that none of the given models refer to, and deletes them if force is set.
+// Every manifest must be fetched successfully before anything is deleted.
+func pruneBlobs(ctx context.Context, w io.Writer, client ollamaurl.Registry, dir string, modelNames []string, opts options, force bool) error {
+	// Every blob of a manifest is in use, regardless of the options that leave some out of the output
+	opts.ignoreConfig = false
+	opts.annotations = nil
+	opts.mediaTypes = nil
+
+	referenced := make(map[string]bool)
+	for _, modelName := range modelNames {
+		modelCtx, cancel := opts.modelContext(ctx)
+		plan, err := fetchPlan(modelCtx, client, modelName, opts)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("%s: %w", modelName, err)
+		}
+		for _, blob := range plan.Blobs {
+			// The manifest of a pinned model is stored by its digest, like the blobs
+			if blob.Digest != "" {
+				referenced[ollamaurl.CreateFilename(blob.Digest)] = true
+			}
+		}
+	}
+
+	orphans, err := unreferencedBlobs(dir, referenced)
+	if err != nil {
+		return err
+	}
+	var freed int64
+	for _, name := range orphans {
+		filename := filepath.Join(dir, name)
+		if info, err := os.Stat(filename); err == nil {
+			freed += info.Size()
+		}
+		if !force {
+			fmt.Fprintf(w, "would delete %s\n", filename)
+			continue
+		}
+		if err := os.Remove(filename); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "deleted %s\n", filename)
+	}
+	if force {
+		fmt.Fprintf(w, "Deleted %d unreferenced blobs, %s\n", len(orphans), humanSize(freed))
+	} else {
+		fmt.Fprintf(w, "Found %d unreferenced blobs, %s. Run again with --force to delete them.\n", len(orphans), humanSize(freed))
+	}
+	return nil
+}
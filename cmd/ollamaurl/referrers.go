@@ -0,0 +1,33 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+// sortReferrers orders referrers by artifact type and then digest, since registries
+// do not promise any particular order
+func sortReferrers(referrers []ollamaurl.Descriptor) {
+	slices.SortStableFunc(referrers, func(a, b ollamaurl.Descriptor) int {
+		return cmp.Or(cmp.Compare(a.ArtifactType, b.ArtifactType), cmp.Compare(a.Digest, b.Digest))
+	})
+}
+
+// writeReferrers lists one artifact per line, with its digest, type and size
+func writeReferrers(w io.Writer, manifestDigest string, referrers []ollamaurl.Descriptor) {
+	if len(referrers) == 0 {
+		fmt.Fprintf(w, "No artifacts refer to %s\n", manifestDigest)
+		return
+	}
+	for _, referrer := range referrers {
+		artifactType := referrer.ArtifactType
+		if artifactType == "" {
+			artifactType = referrer.MediaType
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", referrer.Digest, artifactType, humanSize(referrer.Size))
+	}
+}
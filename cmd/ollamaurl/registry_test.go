@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+var errNotFaked = errors.New("not supported by the fake registry")
+
+// fakeRegistry is a Registry that serves manifests from memory, so that what is done with
+// a manifest can be tested without a registry. The blob methods are not supported.
+type fakeRegistry struct {
+	base      *url.URL
+	manifests map[string]ollamaurl.Manifest // keyed by repository and reference, like "library/tinyllama:latest"
+}
+
+var _ ollamaurl.Registry = (*fakeRegistry)(nil)
+
+// testDigest returns a valid digest that is made of a single repeated hex digit
+func testDigest(hex string) string {
+	return "sha256:" + strings.Repeat(hex, 64)
+}
+
+// newFakeRegistry returns a fake registry with library/tinyllama:latest, which has a config
+// blob and a model, a template and a license layer, and the same manifest pinned by digest
+func newFakeRegistry() *fakeRegistry {
+	manifest := ollamaurl.Manifest{
+		SchemaVersion: 2,
+		MediaType:     "application/vnd.docker.distribution.manifest.v2+json",
+		Config:        ollamaurl.Layer{Digest: testDigest("c"), Size: 10, MediaType: "application/vnd.docker.container.image.v1+json"},
+		Layers: []ollamaurl.Layer{
+			{Digest: testDigest("1"), Size: 1000, MediaType: ollamaurl.ModelMediaType, Annotations: map[string]string{"role": "weights"}},
+			{Digest: testDigest("2"), Size: 20, MediaType: ollamaurl.MediaTypePrefix + "template"},
+			{Digest: testDigest("3"), Size: 30, MediaType: ollamaurl.MediaTypePrefix + "license", Annotations: map[string]string{"role": "legal"}},
+		},
+		Digest: testDigest("f"),
+	}
+	return &fakeRegistry{
+		base: &url.URL{Scheme: "https", Host: "registry.test"},
+		manifests: map[string]ollamaurl.Manifest{
+			"library/tinyllama:latest":             manifest,
+			"library/tinyllama:" + testDigest("f"): manifest,
+		},
+	}
+}
+
+// GetManifest returns a copy of the manifest, since the layers are filtered in place
+func (f *fakeRegistry) GetManifest(ctx context.Context, repository, reference string, verbose bool) (*ollamaurl.Manifest, error) {
+	manifest, found := f.manifests[repository+":"+reference]
+	if !found {
+		return nil, fmt.Errorf("%w: %s:%s", ollamaurl.ErrModelNotFound, repository, reference)
+	}
+	manifest.Layers = slices.Clone(manifest.Layers)
+	manifest.Registry = f.base
+	return &manifest, nil
+}
+
+func (f *fakeRegistry) ManifestDigest(ctx context.Context, repository, reference string) (string, error) {
+	manifest, err := f.GetManifest(ctx, repository, reference, false)
+	if err != nil {
+		return "", err
+	}
+	return manifest.Digest, nil
+}
+
+func (f *fakeRegistry) GetReferrers(ctx context.Context, repository, digest string) ([]ollamaurl.Descriptor, error) {
+	return nil, errNotFaked
+}
+
+func (f *fakeRegistry) ListTags(ctx context.Context, repository string) (*ollamaurl.TagList, error) {
+	return nil, errNotFaked
+}
+
+func (f *fakeRegistry) GetBlob(ctx context.Context, repository, digest string) (io.ReadCloser, error) {
+	return nil, errNotFaked
+}
+
+func (f *fakeRegistry) GetBlobFrom(ctx context.Context, repository, digest string, offset int64) (io.ReadCloser, int64, error) {
+	return nil, 0, errNotFaked
+}
+
+func (f *fakeRegistry) GetBlobRange(ctx context.Context, repository, digest string, n int64) (io.ReadCloser, error) {
+	return nil, errNotFaked
+}
+
+func (f *fakeRegistry) HeadBlob(ctx context.Context, repository, digest string) (int64, error) {
+	return 0, errNotFaked
+}
+
+func (f *fakeRegistry) BlobHeaders(ctx context.Context, repository, digest string) (http.Header, error) {
+	return nil, errNotFaked
+}
+
+func (f *fakeRegistry) ManifestRequest(ctx context.Context, repository, reference string) (*http.Request, error) {
+	return nil, errNotFaked
+}
+
+func (f *fakeRegistry) BlobRequest(ctx context.Context, repository, digest string) (*http.Request, error) {
+	return nil, errNotFaked
+}
+
+func (f *fakeRegistry) VerifyBlob(digest string, r io.Reader) error {
+	return errNotFaked
+}
+
+func (f *fakeRegistry) VerifyManifestSignature(ctx context.Context, repository, manifestDigest string, key crypto.PublicKey) error {
+	return errNotFaked
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+// knownLayerKinds are the layer media types that Ollama uses, without the common prefix
+var knownLayerKinds = []string{"model", "embed", "adapter", "projector", "prompt", "template", "system", "params", "messages", "license"}
+
+// checkMediaTypes returns an error for the first layer with a media type that is not a known Ollama one
+func checkMediaTypes(manifest *ollamaurl.Manifest) error {
+	for i, layer := range manifest.Layers {
+		kind, found := strings.CutPrefix(layer.MediaType, ollamaurl.MediaTypePrefix)
+		if !found || !slices.Contains(knownLayerKinds, kind) {
+			return fmt.Errorf("layer %d (%s) has the unknown media type %q", i, layer.Digest, layer.MediaType)
+		}
+	}
+	return nil
+}
+
+// MediaTypeCount is the number of blobs and their combined size for one media type
+type MediaTypeCount struct {
+	MediaType string `json:"mediaType"`
+	Count     int    `json:"count"`
+	Size      int64  `json:"size"`
+}
+
+// humanSize formats a byte count using binary units, like "4.1 GiB"
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	s := fmt.Sprintf("%.1f", float64(n)/float64(div))
+	s = strings.TrimSuffix(s, ".0")
+	return s + " " + string("KMGTPE"[exp]) + "iB"
+}
+
+// shortMediaType strips the common Ollama prefix, so that
+// "application/vnd.ollama.image.model" becomes "model"
+func shortMediaType(mediaType string) string {
+	if short := strings.TrimPrefix(mediaType, ollamaurl.MediaTypePrefix); short != "" {
+		return short
+	}
+	return mediaType
+}
+
+// countByMediaType groups the config and layers of a manifest by media type,
+// in the order each media type first appears
+func countByMediaType(manifest *ollamaurl.Manifest) []MediaTypeCount {
+	var counts []MediaTypeCount
+	index := make(map[string]int)
+	add := func(layer ollamaurl.Layer) {
+		i, ok := index[layer.MediaType]
+		if !ok {
+			i = len(counts)
+			index[layer.MediaType] = i
+			counts = append(counts, MediaTypeCount{MediaType: layer.MediaType})
+		}
+		counts[i].Count++
+		counts[i].Size += layer.Size
+	}
+	if manifest.Config.Digest != "" {
+		add(manifest.Config)
+	}
+	for _, layer := range manifest.Layers {
+		add(layer)
+	}
+	return counts
+}
+
+// writeMediaTypeSummary writes the media type counts either as a single line of text or as JSON
+func writeMediaTypeSummary(w io.Writer, counts []MediaTypeCount, format string) error {
+	switch format {
+	case "json":
+		if counts == nil {
+			counts = []MediaTypeCount{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(counts)
+	case "text":
+		parts := make([]string, len(counts))
+		for i, c := range counts {
+			noun := "blobs"
+			if c.Count == 1 {
+				noun = "blob"
+			}
+			parts[i] = fmt.Sprintf("%s: %d %s, %s", shortMediaType(c.MediaType), c.Count, noun, humanSize(c.Size))
+		}
+		_, err := fmt.Fprintln(w, strings.Join(parts, "; "))
+		return err
+	}
+	return fmt.Errorf("unknown summary format %q, use text or json", format)
+}
+
+// writePlanSummary writes a footer with the number of layers, the total size and the largest blob
+func writePlanSummary(w io.Writer, plan *ollamaurl.Plan) {
+	noun := "layers"
+	if plan.Layers == 1 {
+		noun = "layer"
+	}
+	line := fmt.Sprintf("Total: %d %s, %s", plan.Layers, noun, humanSize(plan.TotalSize))
+	for _, blob := range plan.Blobs {
+		if blob.Digest == plan.LargestLayer && !blob.IsManifest() {
+			line += fmt.Sprintf(", the largest is %s (%s)", shortDigest(blob.Digest), humanSize(blob.Size))
+			break
+		}
+	}
+	fmt.Fprintln(w, line)
+	if plan.SizeIncomplete {
+		fmt.Fprintln(w, "Some blobs have no size in the manifest, so the total may be incomplete")
+	}
+}
+
+// headConcurrency is the number of HEAD requests that are in flight at the same time
+const headConcurrency = 4
+
+// sizedLayers returns the config, if there is one, and the layers of a manifest
+func sizedLayers(manifest *ollamaurl.Manifest) []ollamaurl.Layer {
+	var layers []ollamaurl.Layer
+	if manifest.Config.Digest != "" {
+		layers = append(layers, manifest.Config)
+	}
+	return append(layers, manifest.Layers...)
+}
+
+// headSizes sends a HEAD request for each layer, concurrently, and returns the
+// Content-Length of each response, or -1 if there was none, along with any errors
+func headSizes(ctx context.Context, client ollamaurl.Registry, repository string, layers []ollamaurl.Layer) ([]int64, []error) {
+	sizes := make([]int64, len(layers))
+	errs := make([]error, len(layers))
+	semaphore := make(chan struct{}, headConcurrency)
+	var wg sync.WaitGroup
+	for i, layer := range layers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			sizes[i], errs[i] = client.HeadBlob(ctx, repository, layer.Digest)
+		}()
+	}
+	wg.Wait()
+	return sizes, errs
+}
+
+// headTotal sends a HEAD request for the config and every layer, concurrently,
+// and sums up the Content-Length of each response. It also returns how many
+// blobs that had no Content-Length.
+func headTotal(ctx context.Context, client ollamaurl.Registry, repository string, manifest *ollamaurl.Manifest) (int64, int, error) {
+	sizes, errs := headSizes(ctx, client, repository, sizedLayers(manifest))
+	if err := errors.Join(errs...); err != nil {
+		return 0, 0, err
+	}
+	var total int64
+	unknown := 0
+	for _, size := range sizes {
+		if size < 0 {
+			unknown++
+			continue
+		}
+		total += size
+	}
+	return total, unknown, nil
+}
+
+// writeSizes lists the size of the config and every layer according to HEAD requests, and the total.
+// The size from the manifest is used when the registry does not support HEAD requests or
+// sends no Content-Length, and a warning is written to stderr when both are known and they disagree.
+func writeSizes(ctx context.Context, w io.Writer, client ollamaurl.Registry, repository string, manifest *ollamaurl.Manifest) error {
+	layers := sizedLayers(manifest)
+	sizes, errs := headSizes(ctx, client, repository, layers)
+	var total int64
+	for i, layer := range layers {
+		size, source := sizes[i], "registry"
+		switch {
+		case errors.Is(errs[i], ollamaurl.ErrHeadNotSupported) || (errs[i] == nil && size < 0):
+			size, source = layer.Size, "manifest"
+		case errs[i] != nil:
+			return errs[i]
+		case layer.Size > 0 && size != layer.Size:
+			// A size of 0 in the manifest means that it is missing, which is why the registry is asked
+			fmt.Fprintf(os.Stderr, "Warning: the registry reports %d bytes for %s, but the manifest says %d\n", size, layer.Digest, layer.Size)
+		}
+		total += size
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", layer.Digest, shortMediaType(layer.MediaType), size, humanSize(size), source)
+	}
+	fmt.Fprintf(w, "Total: %s (%d bytes)\n", humanSize(total), total)
+	return nil
+}
+
+// GrandTotal adds up the blobs of several models, counting a blob that is shared by
+// more than one model only once, which is what mirroring the set of models needs
+type GrandTotal struct {
+	Models int   `json:"models"`
+	Blobs  int   `json:"blobs"`
+	Size   int64 `json:"size"`
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+// add counts the config and layers of a manifest
+func (t *GrandTotal) add(manifest *ollamaurl.Manifest) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.seen == nil {
+		t.seen = make(map[string]bool)
+	}
+	t.Models++
+	layers := manifest.Layers
+	if manifest.Config.Digest != "" {
+		layers = append([]ollamaurl.Layer{manifest.Config}, layers...)
+	}
+	for _, layer := range layers {
+		if t.seen[layer.Digest] {
+			continue
+		}
+		t.seen[layer.Digest] = true
+		t.Blobs++
+		t.Size += layer.Size
+	}
+}
+
+// write writes the grand total as a single line of text
+func (t *GrandTotal) write(w io.Writer) {
+	noun := "models"
+	if t.Models == 1 {
+		noun = "model"
+	}
+	fmt.Fprintf(w, "Grand total: %s (%d bytes) in %d unique blobs across %d %s\n", humanSize(t.Size), t.Size, t.Blobs, t.Models, noun)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+// writeTags lists the tags of a model, one per line or as JSON. The tag of the model name, if any, is ignored.
+func writeTags(ctx context.Context, client ollamaurl.Registry, modelName string, opts options, w io.Writer) error {
+	ref, err := ollamaurl.ParseModelPath(modelName, opts.defaults)
+	if err != nil {
+		return fmt.Errorf("parsing model name: %w", err)
+	}
+	if opts.printRef {
+		printRef(modelName, ref)
+	}
+	list, err := client.ListTags(ctx, ref.Path())
+	if err != nil {
+		return err
+	}
+	if opts.repeatableOrder {
+		slices.Sort(list.Tags)
+	}
+	if opts.json {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(list)
+	}
+	for _, tag := range list.Tags {
+		fmt.Fprintln(w, tag)
+	}
+	return nil
+}
+
+// writeLatestDigest writes the digest of the manifest that the tag of a model points to right now,
+// as the registry reports it, so that the model can be pinned to it
+func writeLatestDigest(ctx context.Context, client ollamaurl.Registry, modelName string, opts options, w io.Writer) error {
+	ref, err := ollamaurl.ParseModelPath(modelName, opts.defaults)
+	if err != nil {
+		return fmt.Errorf("parsing model name: %w", err)
+	}
+	if opts.printRef {
+		printRef(modelName, ref)
+	}
+	digest, err := client.ManifestDigest(ctx, ref.Path(), ref.Reference())
+	if errors.Is(err, ollamaurl.ErrModelNotFound) && ref.Digest == "" {
+		return fmt.Errorf("%w (--list-tags lists the tags of %s)", err, ref.Path())
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, digest)
+	return err
+}
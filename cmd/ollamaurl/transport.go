@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// tlsVersions are the values accepted by --min-tls-version
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// transportOptions configures the HTTP transport that is shared by all registry requests
+type transportOptions struct {
+	clientCert    string
+	clientKey     string
+	minTLSVersion string
+	bindAddr      string
+	proxy         string
+	insecure      bool
+
+	connectTimeout time.Duration // for the TCP connection and for the TLS handshake
+	headerTimeout  time.Duration // from sending the request until the response headers arrive
+}
+
+// localAddr parses the --bind-addr value, and checks that one of the network interfaces has it
+func localAddr(addr string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, fmt.Errorf("--bind-addr %q is not an IP address", addr)
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("listing the network interface addresses: %w", err)
+	}
+	for _, a := range addrs {
+		if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return &net.TCPAddr{IP: ip}, nil
+		}
+	}
+	return nil, fmt.Errorf("--bind-addr %s is not an address of any network interface on this machine", addr)
+}
+
+// parseProxyURL parses the --proxy value, which must be an http, https or socks5 URL with a host
+func parseProxyURL(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --proxy: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported --proxy scheme %q, use http, https or socks5", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("--proxy %q has no host", proxy)
+	}
+	return u, nil
+}
+
+// parseTLSVersion turns a version like "1.3" into the tls package constant
+func parseTLSVersion(version string) (uint16, error) {
+	v, ok := tlsVersions[strings.TrimPrefix(version, "TLS")]
+	if !ok {
+		return 0, fmt.Errorf("unsupported --min-tls-version %q, use 1.2 or 1.3", version)
+	}
+	return v, nil
+}
+
+// newTransport creates a transport based on the default one, with the given options applied
+func newTransport(opts transportOptions) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+
+	minVersion, err := parseTLSVersion(opts.minTLSVersion)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig.MinVersion = minVersion
+	transport.TLSClientConfig.InsecureSkipVerify = opts.insecure
+
+	// Without --proxy, the default transport uses $HTTPS_PROXY, $HTTP_PROXY and $NO_PROXY
+	if opts.proxy != "" {
+		proxyURL, err := parseProxyURL(opts.proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	// Connecting and waiting for the response headers have their own timeouts, but reading the
+	// body has none, so that a large blob can take as long as it needs, for as long as data keeps coming
+	dialer := &net.Dialer{
+		Timeout:   opts.connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	transport.TLSHandshakeTimeout = opts.connectTimeout
+	transport.ResponseHeaderTimeout = opts.headerTimeout
+	transport.DialContext = dialer.DialContext
+
+	if opts.bindAddr != "" {
+		local, err := localAddr(opts.bindAddr)
+		if err != nil {
+			return nil, err
+		}
+		dialer.LocalAddr = local
+		transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, address)
+			if err != nil {
+				return nil, fmt.Errorf("connecting from %s: %w", opts.bindAddr, err)
+			}
+			return conn, nil
+		}
+	}
+
+	if opts.clientCert != "" || opts.clientKey != "" {
+		if opts.clientCert == "" || opts.clientKey == "" {
+			return nil, fmt.Errorf("both --client-cert and --client-key are needed for mutual TLS")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.clientCert, opts.clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return transport, nil
+}
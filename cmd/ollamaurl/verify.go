@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/xyproto/ollamaurl"
+)
+
+// verifyResult is the outcome of checking one downloaded blob
+type verifyResult struct {
+	filename string
+	err      error
+}
+
+// sha256File returns the hex encoded sha256 sum of a file
+func sha256File(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// verifyBlobFile checks that a downloaded file matches the digest of its blob
+func verifyBlobFile(dir string, blob ollamaurl.Blob) error {
+	algorithm, expected, _ := strings.Cut(blob.Digest, ":")
+	if algorithm != "sha256" {
+		return fmt.Errorf("unsupported digest algorithm %q", algorithm)
+	}
+	actual, err := sha256File(filepath.Join(dir, blob.Filename))
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return fmt.Errorf("got sha256:%s", actual)
+	}
+	return nil
+}
+
+// verifyBlobs hashes the files for all blobs in dir, using up to concurrency workers.
+// The results are in the same order as the blobs. The manifest is checked too if the model is
+// pinned by digest, and skipped otherwise, since a manifest that is fetched by tag can change.
+func verifyBlobs(dir string, blobs []ollamaurl.Blob, concurrency int) []verifyResult {
+	var toVerify []ollamaurl.Blob
+	for _, blob := range blobs {
+		if !blob.IsManifest() || blob.Digest != "" {
+			toVerify = append(toVerify, blob)
+		}
+	}
+
+	results := make([]verifyResult, len(toVerify))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(1, min(concurrency, len(toVerify))) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = verifyResult{toVerify[i].Filename, verifyBlobFile(dir, toVerify[i])}
+			}
+		}()
+	}
+	for i := range toVerify {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// writeVerifyResults prints one line per blob and a summary, and returns the number of failures
+func writeVerifyResults(w io.Writer, results []verifyResult) int {
+	failed := 0
+	for _, result := range results {
+		if result.err != nil {
+			failed++
+			fmt.Fprintf(w, "FAILED %s: %v\n", result.filename, result.err)
+			continue
+		}
+		fmt.Fprintf(w, "OK %s\n", result.filename)
+	}
+	fmt.Fprintf(w, "%d passed, %d failed\n", len(results)-failed, failed)
+	return failed
+}
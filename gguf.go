@@ -0,0 +1,241 @@
+package ollamaurl
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	ggufMagic           = "GGUF"
+	ModelMediaType      = MediaTypePrefix + "model"
+	maxGGUFStringLength = 1 << 24
+	maxGGUFValueLength  = 120 // longer strings are shortened when printed
+)
+
+// GGUF metadata value types
+const (
+	ggufUint8 uint32 = iota
+	ggufInt8
+	ggufUint16
+	ggufInt16
+	ggufUint32
+	ggufInt32
+	ggufFloat32
+	ggufBool
+	ggufString
+	ggufArray
+	ggufUint64
+	ggufInt64
+	ggufFloat64
+)
+
+var ggufTypeNames = []string{"uint8", "int8", "uint16", "int16", "uint32", "int32", "float32", "bool", "string", "array", "uint64", "int64", "float64"}
+
+// GGUFKeyValue is one metadata entry from a GGUF header, with the value formatted as text
+type GGUFKeyValue struct {
+	Key   string
+	Value string
+}
+
+// GGUFHeader is the metadata found at the start of a GGUF file
+type GGUFHeader struct {
+	Version     uint32
+	TensorCount uint64
+	Metadata    []GGUFKeyValue
+}
+
+// GetBlobRange opens a stream for the first n bytes of a blob, using a Range request.
+// If the registry ignores the range, the stream is cut off after n bytes anyway.
+func (c *Client) GetBlobRange(ctx context.Context, modelName, digest string, n int64) (io.ReadCloser, error) {
+	req, err := c.newBlobRequest(ctx, http.MethodGet, ConstructBlobURL(c.registryFor(modelName), modelName, digest))
+	if err != nil {
+		return nil, fmt.Errorf("creating HTTP request: %w", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", n-1))
+	resp, err := c.doWithRetries(req, c.blobRetries)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch blob %s: %s", digest, resp.Status)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(resp.Body, n), resp.Body}, nil
+}
+
+// ggufReader reads little endian GGUF values
+type ggufReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (g *ggufReader) read(v any) {
+	if g.err == nil {
+		g.err = binary.Read(g.r, binary.LittleEndian, v)
+	}
+}
+
+func (g *ggufReader) uint32() uint32 {
+	var v uint32
+	g.read(&v)
+	return v
+}
+
+func (g *ggufReader) uint64() uint64 {
+	var v uint64
+	g.read(&v)
+	return v
+}
+
+func (g *ggufReader) string() string {
+	n := g.uint64()
+	if g.err != nil {
+		return ""
+	}
+	if n > maxGGUFStringLength {
+		g.err = fmt.Errorf("string of %d bytes is too long", n)
+		return ""
+	}
+	buf := make([]byte, n)
+	_, g.err = io.ReadFull(g.r, buf)
+	return string(buf)
+}
+
+// scalar reads a single value of the given type and formats it
+func (g *ggufReader) scalar(valueType uint32) string {
+	switch valueType {
+	case ggufUint8:
+		var v uint8
+		g.read(&v)
+		return strconv.FormatUint(uint64(v), 10)
+	case ggufInt8:
+		var v int8
+		g.read(&v)
+		return strconv.FormatInt(int64(v), 10)
+	case ggufUint16:
+		var v uint16
+		g.read(&v)
+		return strconv.FormatUint(uint64(v), 10)
+	case ggufInt16:
+		var v int16
+		g.read(&v)
+		return strconv.FormatInt(int64(v), 10)
+	case ggufUint32:
+		return strconv.FormatUint(uint64(g.uint32()), 10)
+	case ggufInt32:
+		var v int32
+		g.read(&v)
+		return strconv.FormatInt(int64(v), 10)
+	case ggufFloat32:
+		return strconv.FormatFloat(float64(math.Float32frombits(g.uint32())), 'g', -1, 32)
+	case ggufBool:
+		var v uint8
+		g.read(&v)
+		return strconv.FormatBool(v != 0)
+	case ggufString:
+		s := g.string()
+		if len(s) > maxGGUFValueLength {
+			s = s[:maxGGUFValueLength] + "..."
+		}
+		return strconv.Quote(s)
+	case ggufUint64:
+		return strconv.FormatUint(g.uint64(), 10)
+	case ggufInt64:
+		return strconv.FormatInt(int64(g.uint64()), 10)
+	case ggufFloat64:
+		return strconv.FormatFloat(math.Float64frombits(g.uint64()), 'g', -1, 64)
+	}
+	if g.err == nil {
+		g.err = fmt.Errorf("unknown value type %d", valueType)
+	}
+	return ""
+}
+
+// value reads a value of the given type. Arrays are summarized by their element
+// type and length, except for short arrays of numbers, which are listed.
+func (g *ggufReader) value(valueType uint32) string {
+	if valueType != ggufArray {
+		return g.scalar(valueType)
+	}
+	elementType := g.uint32()
+	count := g.uint64()
+	if g.err != nil {
+		return ""
+	}
+	if elementType == ggufArray {
+		g.err = errors.New("nested arrays are not supported")
+		return ""
+	}
+	var items []string
+	for i := uint64(0); i < count && g.err == nil; i++ {
+		item := g.scalar(elementType)
+		if i < 8 && elementType != ggufString {
+			items = append(items, item)
+		}
+	}
+	if count <= 8 && elementType != ggufString {
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	typeName := "unknown"
+	if int(elementType) < len(ggufTypeNames) {
+		typeName = ggufTypeNames[elementType]
+	}
+	return fmt.Sprintf("[%s array, %d items]", typeName, count)
+}
+
+// ParseGGUFHeader reads the GGUF magic, version, counts and all metadata key-value pairs
+func ParseGGUFHeader(r io.Reader) (*GGUFHeader, error) {
+	g := &ggufReader{r: bufio.NewReader(r)}
+	magic := make([]byte, len(ggufMagic))
+	if _, err := io.ReadFull(g.r, magic); err != nil {
+		return nil, fmt.Errorf("reading GGUF magic: %w", err)
+	}
+	if string(magic) != ggufMagic {
+		return nil, fmt.Errorf("not a GGUF file, the magic bytes are %q", magic)
+	}
+	header := &GGUFHeader{Version: g.uint32()}
+	var metadataCount uint64
+	if header.Version == 1 {
+		// Version 1 used 32-bit counts
+		header.TensorCount = uint64(g.uint32())
+		metadataCount = uint64(g.uint32())
+	} else {
+		header.TensorCount = g.uint64()
+		metadataCount = g.uint64()
+	}
+	for i := uint64(0); i < metadataCount && g.err == nil; i++ {
+		key := g.string()
+		value := g.value(g.uint32())
+		if g.err == nil {
+			header.Metadata = append(header.Metadata, GGUFKeyValue{Key: key, Value: value})
+		}
+	}
+	if errors.Is(g.err, io.EOF) || errors.Is(g.err, io.ErrUnexpectedEOF) {
+		return header, fmt.Errorf("the GGUF header is longer than the downloaded part, after %d of %d metadata entries", len(header.Metadata), metadataCount)
+	}
+	if g.err != nil {
+		return header, fmt.Errorf("reading GGUF metadata: %w", g.err)
+	}
+	return header, nil
+}
+
+// ModelLayer returns the layer that holds the model weights
+func ModelLayer(manifest *Manifest) (Layer, error) {
+	for _, layer := range manifest.Layers {
+		if layer.MediaType == ModelMediaType {
+			return layer, nil
+		}
+	}
+	return Layer{}, fmt.Errorf("the manifest has no layer with media type %s", ModelMediaType)
+}
@@ -0,0 +1,111 @@
+package ollamaurl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"runtime"
+	"strings"
+)
+
+// Platform is the operating system and architecture that a manifest in a manifest list is for
+type Platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// String returns the platform as os/architecture or os/architecture/variant
+func (p Platform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// HostPlatform returns the platform that the program is running on
+func HostPlatform() Platform {
+	return Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH}
+}
+
+// ParsePlatform parses a platform like linux/amd64 or linux/arm64/v8
+func ParsePlatform(s string) (Platform, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Platform{}, fmt.Errorf("invalid platform %q, expected os/architecture or os/architecture/variant", s)
+	}
+	p := Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+// matches reports if an entry for the other platform can be used for this one.
+// Without a variant, any variant matches.
+func (p Platform) matches(other *Platform) bool {
+	return other != nil && other.OS == p.OS && other.Architecture == p.Architecture &&
+		(p.Variant == "" || other.Variant == p.Variant)
+}
+
+// ManifestList is a Docker manifest list or an OCI image index, with a manifest per platform.
+// The referrers API answers with the same structure.
+type ManifestList struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Manifests     []Descriptor `json:"manifests"`
+}
+
+// Select returns the first manifest for the given platform, or an error that lists
+// the platforms that are available
+func (l *ManifestList) Select(platform Platform) (Descriptor, error) {
+	var available []string
+	for _, descriptor := range l.Manifests {
+		if platform.matches(descriptor.Platform) {
+			return descriptor, nil
+		}
+		if descriptor.Platform != nil {
+			available = append(available, descriptor.Platform.String())
+		}
+	}
+	if len(available) == 0 {
+		return Descriptor{}, fmt.Errorf("no manifest for platform %s, the manifest list has no platforms", platform)
+	}
+	return Descriptor{}, fmt.Errorf("no manifest for platform %s, available: %s", platform, strings.Join(available, ", "))
+}
+
+// SetPlatform sets the platform that is picked from manifest lists.
+// Without one, the platform of the host is used.
+func (c *Client) SetPlatform(platform Platform) {
+	c.platform = platform
+}
+
+// resolveManifestList picks the manifest for the platform of the client from a manifest list,
+// and fetches it by its digest
+func (c *Client) resolveManifestList(ctx context.Context, base *url.URL, repository string, data []byte, verbose bool) (*Manifest, error) {
+	var list ManifestList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("decoding manifest list JSON: %w", err)
+	}
+	platform := c.platform
+	if platform == (Platform{}) {
+		platform = HostPlatform()
+	}
+	descriptor, err := list.Select(platform)
+	if err != nil {
+		return nil, err
+	}
+	if verbose {
+		fmt.Printf("Selected the manifest for %s from the manifest list: digest = %s\n", platform, descriptor.Digest)
+	}
+	manifest, err := c.getManifest(ctx, base, repository, descriptor.Digest, verbose)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Platform == nil {
+		manifest.Platform = descriptor.Platform
+	}
+	return manifest, nil
+}
@@ -0,0 +1,175 @@
+package ollamaurl
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Limits from the OCI distribution spec naming constraints
+	maxRepoComponentLength = 255
+	maxTagLength           = 128
+)
+
+var (
+	repoComponentPattern = regexp.MustCompile(`^[a-z0-9]+(?:(?:\.|_|__|-+)[a-z0-9]+)*$`)
+	tagPattern           = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]*$`)
+	digestPattern        = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+)
+
+// ModelRef is a parsed model name, like library/tinyllama:latest
+type ModelRef struct {
+	Namespace  string
+	Repository string
+	Tag        string // empty when the model is pinned by digest
+	Digest     string // only set when the model is pinned by digest
+}
+
+// ModelDefaults are used for the parts that a model name leaves out
+type ModelDefaults struct {
+	Namespace string
+	Tag       string
+}
+
+// Path returns the repository path that is used in registry URLs, like "library/tinyllama"
+func (r ModelRef) Path() string {
+	return path.Join(r.Namespace, r.Repository)
+}
+
+// Reference returns what the manifest is fetched by, the digest if pinned and otherwise the tag
+func (r ModelRef) Reference() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+// ManifestFilename returns the filename for the manifest, which is derived from the digest if
+// the model is pinned, like the filenames of the blobs, and manifest.json otherwise
+func (r ModelRef) ManifestFilename() string {
+	if r.Digest != "" {
+		return CreateFilename(r.Digest)
+	}
+	return ManifestFilename
+}
+
+func (r ModelRef) String() string {
+	if r.Digest != "" {
+		return r.Path() + "@" + r.Digest
+	}
+	return r.Path() + ":" + r.Tag
+}
+
+// ParseModelPath splits a model name like "tinyllama:latest" or "user/model:tag" into
+// namespace, repository and tag, and checks each part against the registry naming constraints.
+// The defaults are used for a missing namespace or tag.
+// A name pinned by digest, like "tinyllama@sha256:...", has a digest instead of a tag.
+func ParseModelPath(name string, defaults ModelDefaults) (ModelRef, error) {
+	var ref ModelRef
+
+	repoPath, digest, pinned := strings.Cut(name, "@")
+	if pinned {
+		if _, _, hasTag := SplitTag(repoPath); hasTag {
+			return ModelRef{}, fmt.Errorf("%q has both a tag and a digest, use either name:tag or name@sha256:<digest>", name)
+		}
+		if err := ValidateDigest(digest); err != nil {
+			return ModelRef{}, err
+		}
+		ref.Digest = digest
+	} else {
+		var found bool
+		repoPath, ref.Tag, found = SplitTag(name)
+		if !found {
+			ref.Tag = defaults.Tag
+		}
+		if err := validateTag(ref.Tag); err != nil {
+			return ModelRef{}, err
+		}
+	}
+
+	components := strings.Split(repoPath, "/")
+	first := components[0]
+	switch {
+	case len(components) == 1:
+		ref.Namespace, ref.Repository = defaults.Namespace, first
+	case len(components) == 2 && !strings.Contains(first, ":") && first != "localhost":
+		// A host with a port, or localhost, can never be a namespace, while a dot can be part of one
+		ref.Namespace, ref.Repository = first, components[1]
+		if err := ValidateRepositoryComponent(ref.Namespace, "namespace"); err != nil {
+			return ModelRef{}, err
+		}
+	case strings.ContainsAny(first, ".:") || first == "localhost":
+		return ModelRef{}, fmt.Errorf("%q includes a registry host, use --registry https://%s and leave the host out of the model name", name, first)
+	default:
+		return ModelRef{}, fmt.Errorf("%q has too many path components, expected model or namespace/model", name)
+	}
+
+	if len(components) == 1 && ref.Namespace != "" {
+		if err := ValidateRepositoryComponent(ref.Namespace, "namespace"); err != nil {
+			return ModelRef{}, err
+		}
+	}
+	if err := ValidateRepositoryComponent(ref.Repository, "repository"); err != nil {
+		return ModelRef{}, err
+	}
+	return ref, nil
+}
+
+// ValidateModelName checks a model name like ParseModelPath does, without keeping the result
+func ValidateModelName(name string, defaults ModelDefaults) error {
+	_, err := ParseModelPath(name, defaults)
+	return err
+}
+
+// SplitTag splits "name:tag" at the last colon, as long as it comes after the last slash,
+// so that a colon in a host:port is not mistaken for a tag
+func SplitTag(name string) (string, string, bool) {
+	i := strings.LastIndex(name, ":")
+	if i < 0 || i < strings.LastIndex(name, "/") {
+		return name, "", false
+	}
+	return name[:i], name[i+1:], true
+}
+
+// IsPinned reports if a model name refers to a manifest by digest rather than by a tag
+func IsPinned(name string) bool {
+	return strings.Contains(name, "@")
+}
+
+// ValidateRepositoryComponent checks a single namespace or repository name
+func ValidateRepositoryComponent(component, what string) error {
+	if component == "" {
+		return fmt.Errorf("the %s name can not be empty", what)
+	}
+	if len(component) > maxRepoComponentLength {
+		return fmt.Errorf("%s %q is %d characters long, the maximum is %d", what, component[:32]+"...", len(component), maxRepoComponentLength)
+	}
+	if !repoComponentPattern.MatchString(component) {
+		return fmt.Errorf("invalid %s name %q: it must be lowercase letters and digits, optionally separated by '.', '_', '__' or '-'", what, component)
+	}
+	return nil
+}
+
+// ValidateDigest checks that a digest looks like sha256:<64 hex digits>
+func ValidateDigest(digest string) error {
+	if !digestPattern.MatchString(digest) {
+		return fmt.Errorf("invalid digest %q, expected sha256: followed by 64 lowercase hex digits", digest)
+	}
+	return nil
+}
+
+// validateTag checks that a tag has a valid length and only allowed characters
+func validateTag(tag string) error {
+	if tag == "" {
+		return fmt.Errorf("the tag can not be empty")
+	}
+	if len(tag) > maxTagLength {
+		return fmt.Errorf("tag %q is %d characters long, the maximum is %d", tag[:32]+"...", len(tag), maxTagLength)
+	}
+	if !tagPattern.MatchString(tag) {
+		return fmt.Errorf("invalid tag %q: only letters, digits, '_', '.' and '-' are allowed, and it can not start with '.' or '-'", tag)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package ollamaurl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseModelPath(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	defaults := ModelDefaults{Namespace: DefaultNamespace, Tag: DefaultTag}
+	tests := []struct {
+		name     string
+		model    string
+		defaults ModelDefaults
+		want     ModelRef
+		wantErr  bool
+	}{
+		{"defaults", "tinyllama", defaults, ModelRef{Namespace: "library", Repository: "tinyllama", Tag: "latest"}, false},
+		{"tag", "tinyllama:1.1b", defaults, ModelRef{Namespace: "library", Repository: "tinyllama", Tag: "1.1b"}, false},
+		{"namespace", "user/model:tag", defaults, ModelRef{Namespace: "user", Repository: "model", Tag: "tag"}, false},
+		{"namespace with a dot", "my.team/model", defaults, ModelRef{Namespace: "my.team", Repository: "model", Tag: "latest"}, false},
+		{"default tag", "tinyllama", ModelDefaults{Namespace: DefaultNamespace, Tag: "1.1b"}, ModelRef{Namespace: "library", Repository: "tinyllama", Tag: "1.1b"}, false},
+		{"no namespace", "tinyllama", ModelDefaults{Tag: DefaultTag}, ModelRef{Repository: "tinyllama", Tag: "latest"}, false},
+		{"pinned", "tinyllama@" + digest, defaults, ModelRef{Namespace: "library", Repository: "tinyllama", Digest: digest}, false},
+		{"pinned with a namespace", "user/model@" + digest, defaults, ModelRef{Namespace: "user", Repository: "model", Digest: digest}, false},
+		{"tag and digest", "tinyllama:latest@" + digest, defaults, ModelRef{}, true},
+		{"short digest", "tinyllama@sha256:abc", defaults, ModelRef{}, true},
+		{"empty tag", "tinyllama:", defaults, ModelRef{}, true},
+		{"invalid tag", "tinyllama:-x", defaults, ModelRef{}, true},
+		{"uppercase", "TinyLlama", defaults, ModelRef{}, true},
+		{"empty repository", "user/", defaults, ModelRef{}, true},
+		{"registry host", "registry.example.com/user/model", defaults, ModelRef{}, true},
+		{"host with a port", "localhost:5000/model", defaults, ModelRef{}, true},
+		{"localhost", "localhost/model", defaults, ModelRef{}, true},
+		{"too many components", "a/b/c", defaults, ModelRef{}, true},
+		{"invalid default namespace", "tinyllama", ModelDefaults{Namespace: "Not Valid", Tag: DefaultTag}, ModelRef{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseModelPath(tt.model, tt.defaults)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseModelPath(%q) = %+v, want an error", tt.model, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseModelPath(%q): %v", tt.model, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseModelPath(%q) = %+v, want %+v", tt.model, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package ollamaurl
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ollamaLayer and ollamaManifest have the fields, in the order, that Ollama uses when it
+// writes a pulled manifest to disk, which is not always byte for byte what the registry sent.
+// Config is a value, like in Ollama, so a manifest without a config still gets an empty one.
+type ollamaLayer struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	From      string `json:"from,omitempty"`
+}
+
+type ollamaManifest struct {
+	SchemaVersion int           `json:"schemaVersion"`
+	MediaType     string        `json:"mediaType"`
+	Config        ollamaLayer   `json:"config"`
+	Layers        []ollamaLayer `json:"layers"`
+}
+
+// modelIDLength is the number of hex digits that "ollama list" shows
+const modelIDLength = 12
+
+// ModelID returns the ID that "ollama list" shows for a model once it has been pulled:
+// the first 12 hex digits of the sha256 digest of the manifest file that Ollama writes.
+// The manifest is re-encoded the way Ollama does it, so that annotations or a different
+// field order from the registry do not change the result.
+func ModelID(raw []byte) (string, error) {
+	var m ollamaManifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return "", fmt.Errorf("decoding manifest JSON: %w", err)
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(SHA256Digest(data), "sha256:")[:modelIDLength], nil
+}
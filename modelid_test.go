@@ -0,0 +1,39 @@
+package ollamaurl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestModelID(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string // the manifest that Ollama writes to disk
+	}{
+		{
+			"field order and annotations",
+			`{"schemaVersion":2,"mediaType":"m","config":{"size":1,"digest":"sha256:c","mediaType":"c"},"layers":[{"mediaType":"l","digest":"sha256:1","size":2,"annotations":{"a":"b"}}]}`,
+			`{"schemaVersion":2,"mediaType":"m","config":{"mediaType":"c","digest":"sha256:c","size":1},"layers":[{"mediaType":"l","digest":"sha256:1","size":2}]}`,
+		},
+		{
+			"no config",
+			`{"schemaVersion":2,"mediaType":"m","layers":[]}`,
+			`{"schemaVersion":2,"mediaType":"m","config":{"mediaType":"","digest":"","size":0},"layers":[]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ModelID([]byte(tt.raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := strings.TrimPrefix(SHA256Digest([]byte(tt.want)), "sha256:")[:modelIDLength]; got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+	if _, err := ModelID([]byte("{")); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
@@ -0,0 +1,62 @@
+package ollamaurl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// ErrModelNotFound is returned, wrapped, when the registry answers 404 Not Found for a manifest
+var ErrModelNotFound = errors.New("model not found")
+
+// maxSuggestedTags is the most tags that are listed when a tag is not found
+const maxSuggestedTags = 10
+
+// maxErrorBodySize is more than enough for the JSON error response of a registry
+const maxErrorBodySize = 64 << 10
+
+// registryErrorCode returns the code of the first error in an OCI distribution error response,
+// like NAME_UNKNOWN or MANIFEST_UNKNOWN, or "" if the body is not one
+func registryErrorCode(resp *http.Response) string {
+	var body struct {
+		Errors []struct {
+			Code string `json:"code"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxErrorBodySize)).Decode(&body); err != nil || len(body.Errors) == 0 {
+		return ""
+	}
+	return body.Errors[0].Code
+}
+
+// notFoundError explains a 404 for a manifest. The error code from the registry, if any, tells if it
+// is the repository or the manifest that is missing, and the tags of the repository, if the
+// registry lists them, tell which tags exist instead.
+func (c *Client) notFoundError(ctx context.Context, base *url.URL, repository, reference string, resp *http.Response) error {
+	code := registryErrorCode(resp)
+	if code == "NAME_UNKNOWN" {
+		return fmt.Errorf("%w: there is no repository %s, check the namespace and the name", ErrModelNotFound, repository)
+	}
+	if strings.HasPrefix(reference, "sha256:") {
+		return fmt.Errorf("%w: %s has no manifest %s", ErrModelNotFound, repository, reference)
+	}
+	if list, err := c.listTags(ctx, base, repository); err == nil && len(list.Tags) > 0 && !slices.Contains(list.Tags, reference) {
+		tags := list.Tags
+		more := ""
+		if len(tags) > maxSuggestedTags {
+			more = fmt.Sprintf(" and %d more", len(tags)-maxSuggestedTags)
+			tags = tags[:maxSuggestedTags]
+		}
+		return fmt.Errorf("%w: %s has no tag %s, it has %s%s", ErrModelNotFound, repository, reference, strings.Join(tags, ", "), more)
+	}
+	if code == "MANIFEST_UNKNOWN" {
+		return fmt.Errorf("%w: %s has no tag %s, check the tag", ErrModelNotFound, repository, reference)
+	}
+	return fmt.Errorf("%w: %s:%s, check the namespace, the name and the tag", ErrModelNotFound, repository, reference)
+}
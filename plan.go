@@ -0,0 +1,140 @@
+package ollamaurl
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Blob is a single file that is needed for a model, including the manifest itself
+type Blob struct {
+	URL       string `json:"url"`
+	Filename  string `json:"filename"`
+	Digest    string `json:"digest,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	MediaType string `json:"mediaType,omitempty"`
+
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+
+	// Manifest is set for the manifest itself, which is fetched by tag unless the model is pinned
+	Manifest bool `json:"manifest,omitempty"`
+}
+
+// Plan lists the blobs that make up a model, in the order they should be downloaded
+type Plan struct {
+	Model      string `json:"model"`
+	Namespace  string `json:"namespace"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+	TotalSize  int64  `json:"totalSize"` // the config and layers, the manifest is not included
+	Blobs      []Blob `json:"blobs"`
+
+	// Layers is the number of layers, not counting the config
+	Layers int `json:"layers"`
+
+	// LargestLayer is the digest of the largest blob, the config included
+	LargestLayer string `json:"largestLayer,omitempty"`
+
+	// SizeIncomplete is set if the manifest gives a size of 0 for any blob, so that TotalSize may be too low
+	SizeIncomplete bool `json:"sizeIncomplete,omitempty"`
+}
+
+// NewPlan collects the config, the layers and finally the manifest of a model
+func NewPlan(base *url.URL, modelName string, ref ModelRef, manifest *Manifest, verbose bool) *Plan {
+	plan := &Plan{
+		Model:      modelName,
+		Namespace:  ref.Namespace,
+		Repository: ref.Repository,
+		Tag:        ref.Tag,
+		Digest:     ref.Digest,
+	}
+	repository := ref.Path()
+
+	var largest int64
+	count := func(layer Layer) {
+		plan.TotalSize += layer.Size
+		if layer.Size == 0 {
+			plan.SizeIncomplete = true
+		}
+		if layer.Size > largest {
+			largest = layer.Size
+			plan.LargestLayer = layer.Digest
+		}
+	}
+
+	// Process the Config layer if it exists
+	if manifest.Config.Digest != "" {
+		if verbose {
+			fmt.Printf("Processing config layer: digest = %s\n", manifest.Config.Digest)
+		}
+		plan.Blobs = append(plan.Blobs, layerBlob(base, repository, manifest.Config))
+		count(manifest.Config)
+	}
+
+	// Process the Layers
+	for i, layer := range manifest.Layers {
+		if verbose {
+			fmt.Printf("Processing layer %d: digest = %s, mediaType = %s\n", i, layer.Digest, layer.MediaType)
+		}
+		plan.Blobs = append(plan.Blobs, layerBlob(base, repository, layer))
+		count(layer)
+	}
+	plan.Layers = len(manifest.Layers)
+
+	// Include the manifest. One that was picked from a manifest list is fetched by its digest,
+	// since the tag or digest of the model refers to the list.
+	reference, digest := ref.Reference(), ref.Digest
+	if manifest.Platform != nil {
+		reference, digest = manifest.Digest, manifest.Digest
+	}
+	plan.Blobs = append(plan.Blobs, Blob{
+		URL:       ConstructManifestURL(base, repository, reference),
+		Filename:  ref.ManifestFilename(),
+		Digest:    digest,
+		MediaType: manifest.MediaType,
+		Manifest:  true,
+	})
+
+	return plan
+}
+
+// layerBlob describes the blob for a config or content layer
+func layerBlob(base *url.URL, repository string, layer Layer) Blob {
+	return Blob{
+		URL:       ConstructBlobURL(base, repository, layer.Digest),
+		Filename:  CreateFilename(layer.Digest),
+		Digest:    layer.Digest,
+		Size:      layer.Size,
+		MediaType: layer.MediaType,
+
+		Annotations: layer.Annotations,
+	}
+}
+
+// IsManifest reports if this is the manifest entry, which is fetched by tag unless the model is pinned
+func (b Blob) IsManifest() bool {
+	return b.Manifest
+}
+
+// RelativeTo replaces the URL of every blob with its path relative to the registry root
+func (p *Plan) RelativeTo(base *url.URL) {
+	for i, blob := range p.Blobs {
+		p.Blobs[i].URL = RelativeURL(base, blob.URL)
+	}
+}
+
+// RelativeURL turns a URL into its path relative to the registry root,
+// like /v2/library/tinyllama/blobs/sha256:..., keeping any query
+func RelativeURL(base *url.URL, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	rel := &url.URL{
+		Path:     strings.TrimPrefix(u.Path, strings.TrimSuffix(base.Path, "/")),
+		RawQuery: u.RawQuery,
+	}
+	return rel.String()
+}
@@ -0,0 +1,111 @@
+package ollamaurl
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimitLowWater is the number of remaining requests below which the
+// client starts to spread its requests over the time left until the reset
+const rateLimitLowWater = 10
+
+// rateLimit tracks the request budget that a registry reports through the
+// RateLimit-Remaining and RateLimit-Reset headers (or their X- prefixed variants)
+type rateLimit struct {
+	mu        sync.Mutex
+	known     bool
+	remaining int
+	reset     time.Time
+}
+
+// parseRateLimitNumber parses header values like "76" or "76;w=21600"
+func parseRateLimitNumber(value string) (int64, bool) {
+	value, _, _ = strings.Cut(value, ";")
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	return n, err == nil && n >= 0
+}
+
+// headerValue returns the first non-empty value of the given header names
+func headerValue(h http.Header, names ...string) string {
+	for _, name := range names {
+		if v := h.Get(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// update records the budget from the headers of a response, if the registry sent any
+func (r *rateLimit) update(h http.Header, now time.Time) {
+	remaining, ok := parseRateLimitNumber(headerValue(h, "RateLimit-Remaining", "X-RateLimit-Remaining"))
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.known = true
+	r.remaining = int(remaining)
+	r.reset = time.Time{}
+	if reset, ok := parseRateLimitNumber(headerValue(h, "RateLimit-Reset", "X-RateLimit-Reset")); ok {
+		if reset > 1_000_000_000 {
+			// A Unix timestamp rather than a number of seconds
+			r.reset = time.Unix(reset, 0)
+		} else {
+			r.reset = now.Add(time.Duration(reset) * time.Second)
+		}
+	}
+}
+
+// delay returns how long to wait before the next request, and reserves one request from the budget.
+// When the budget is used up, wait until the reset. When it is running low, the remaining
+// requests are spread evenly over the time that is left.
+func (r *rateLimit) delay(now time.Time) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.known || r.reset.IsZero() || !now.Before(r.reset) {
+		return 0
+	}
+	untilReset := r.reset.Sub(now)
+	if r.remaining <= 0 {
+		return untilReset
+	}
+	var d time.Duration
+	if r.remaining < rateLimitLowWater {
+		d = untilReset / time.Duration(r.remaining+1)
+	}
+	r.remaining--
+	return d
+}
+
+// status describes the current budget, for verbose output
+func (r *rateLimit) status(now time.Time) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.known {
+		return "", false
+	}
+	s := strconv.Itoa(r.remaining) + " requests remaining"
+	if !r.reset.IsZero() {
+		s += ", resets in " + r.reset.Sub(now).Round(time.Second).String()
+	}
+	return s, true
+}
+
+// sleepContext waits for the given duration, or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,63 @@
+package ollamaurl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Descriptor points to another manifest or blob, as found in an image index or manifest list
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+
+	// Platform is set for the entries of a manifest list
+	Platform *Platform `json:"platform,omitempty"`
+}
+
+// GetReferrers lists the artifacts, like signatures and SBOMs, that refer to the manifest with the given digest.
+// Registries without the referrers API are asked for the fallback tag sha256-<hex> instead.
+func (c *Client) GetReferrers(ctx context.Context, repository, digest string) ([]Descriptor, error) {
+	referrersURL := resolveRegistryPath(c.registryFor(repository), "v2", repository, "referrers", digest)
+	index, found, err := c.getImageIndex(ctx, referrersURL)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		fallbackURL := ConstructManifestURL(c.registryFor(repository), repository, strings.Replace(digest, ":", "-", 1))
+		if index, found, err = c.getImageIndex(ctx, fallbackURL); err != nil || !found {
+			return nil, err
+		}
+	}
+	return index.Manifests, nil
+}
+
+// getImageIndex fetches and decodes an image index. A 404 is not an error, but reported as not found.
+func (c *Client) getImageIndex(ctx context.Context, indexURL string) (*ManifestList, bool, error) {
+	req, err := c.NewRequest(ctx, http.MethodGet, indexURL)
+	if err != nil {
+		return nil, false, fmt.Errorf("creating HTTP request: %w", err)
+	}
+	req.Header.Set("Accept", MediaTypeOCIIndex)
+	resp, err := c.doWithRetries(req, c.manifestRetries)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("failed to fetch referrers: %s", resp.Status)
+	}
+	var index ManifestList
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return nil, false, fmt.Errorf("decoding referrers JSON: %w", err)
+	}
+	return &index, true, nil
+}
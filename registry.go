@@ -0,0 +1,36 @@
+package ollamaurl
+
+import (
+	"context"
+	"crypto"
+	"io"
+	"net/http"
+)
+
+// Registry is what is needed from a registry to find, fetch and verify the blobs of a model.
+// Client implements it, and anything else that does, like a fake registry in a test, can be
+// used in its place.
+type Registry interface {
+	// Manifests and tags
+	GetManifest(ctx context.Context, repository, reference string, verbose bool) (*Manifest, error)
+	ManifestDigest(ctx context.Context, repository, reference string) (string, error)
+	GetReferrers(ctx context.Context, repository, digest string) ([]Descriptor, error)
+	ListTags(ctx context.Context, repository string) (*TagList, error)
+
+	// Blobs
+	GetBlob(ctx context.Context, repository, digest string) (io.ReadCloser, error)
+	GetBlobFrom(ctx context.Context, repository, digest string, offset int64) (io.ReadCloser, int64, error)
+	GetBlobRange(ctx context.Context, repository, digest string, n int64) (io.ReadCloser, error)
+	HeadBlob(ctx context.Context, repository, digest string) (int64, error)
+	BlobHeaders(ctx context.Context, repository, digest string) (http.Header, error)
+
+	// Requests as they would be sent, without sending them
+	ManifestRequest(ctx context.Context, repository, reference string) (*http.Request, error)
+	BlobRequest(ctx context.Context, repository, digest string) (*http.Request, error)
+
+	// Verification
+	VerifyBlob(digest string, r io.Reader) error
+	VerifyManifestSignature(ctx context.Context, repository, manifestDigest string, key crypto.PublicKey) error
+}
+
+var _ Registry = (*Client)(nil)
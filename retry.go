@@ -0,0 +1,105 @@
+package ollamaurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/bits"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+
+	// MaxRetries is the most retries that SetRetries accepts, which is well over an hour of waiting
+	MaxRetries = 100
+)
+
+// SetRetries sets how many times a failed manifest or blob request is retried.
+// Only network errors, 429 Too Many Requests and 5xx responses are retried.
+// The numbers are limited to between 0 and MaxRetries.
+func (c *Client) SetRetries(manifestRetries, blobRetries int) {
+	c.manifestRetries = min(max(manifestRetries, 0), MaxRetries)
+	c.blobRetries = min(max(blobRetries, 0), MaxRetries)
+}
+
+// shouldRetry reports if a request that ended with this response or error is worth trying again
+func shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		// Network errors are retried, but not a cancelled or expired context, or a refused token
+		return ctx.Err() == nil && !errors.Is(err, ErrUnauthorized)
+	}
+	if resp.Header.Get("Cf-Mitigated") == "challenge" {
+		// An anti-bot challenge does not go away by asking again
+		return false
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// retryAfter parses a Retry-After header, which is either a number of seconds or an HTTP date
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// backoff returns the delay before the given retry, doubling each time up to retryMaxDelay, with jitter
+func backoff(attempt int) time.Duration {
+	d := retryMaxDelay
+	// Compare before shifting, since a large shift overflows
+	if maxShift := bits.Len64(uint64(retryMaxDelay / retryBaseDelay)); attempt < maxShift {
+		d = min(retryBaseDelay<<attempt, retryMaxDelay)
+	}
+	// Somewhere between half and one and a half of the delay
+	return d/2 + rand.N(d)
+}
+
+// doWithRetries performs a request that has no body, and retries it up to the given number of times.
+// The delay between attempts follows Retry-After when the registry sends it, and exponential
+// backoff otherwise. It gives up early if the context deadline would pass while waiting.
+func (c *Client) doWithRetries(req *http.Request, retries int) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		resp, err := c.do(req)
+		if attempt >= retries || !shouldRetry(ctx, resp, err) {
+			return resp, err
+		}
+
+		wait, ok := retryAfter(resp, time.Now())
+		if !ok {
+			wait = backoff(attempt)
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return resp, err
+		}
+
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			resp.Body.Close()
+		}
+		if c.verbose {
+			fmt.Printf("Retrying %s in %s (%d of %d): %s\n", req.URL, wait.Round(time.Millisecond), attempt+1, retries, reason)
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil, errors.Join(fmt.Errorf("retrying %s", req.URL), err)
+		}
+	}
+}
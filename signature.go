@@ -0,0 +1,137 @@
+package ollamaurl
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+	maxSignaturePayloadSize   = 1 << 20
+)
+
+// cosignPayload is the part of a cosign "simple signing" payload that names the signed manifest
+type cosignPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// LoadPublicKey reads a PEM encoded ECDSA, RSA or Ed25519 public key
+func LoadPublicKey(filename string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s does not contain a PEM encoded key", filename)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key in %s: %w", filename, err)
+	}
+	return key, nil
+}
+
+// verifySignatureBytes checks a signature over the sha256 hash of payload
+func verifySignatureBytes(key crypto.PublicKey, payload, signature []byte) error {
+	hash := sha256.Sum256(payload)
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, hash[:], signature) {
+			return errors.New("invalid ECDSA signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, hash[:], signature); err != nil {
+			if rsa.VerifyPSS(k, crypto.SHA256, hash[:], signature, nil) != nil {
+				return errors.New("invalid RSA signature")
+			}
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, payload, signature) {
+			return errors.New("invalid Ed25519 signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported public key type %T", key)
+}
+
+// VerifyManifestSignature looks for a cosign signature of the manifest with the given digest,
+// stored under the tag sha256-<hex>.sig, and checks it against the public key. It succeeds
+// if at least one signature is valid and its payload names the manifest digest.
+func (c *Client) VerifyManifestSignature(ctx context.Context, repository, manifestDigest string, key crypto.PublicKey) error {
+	signatureTag := strings.Replace(manifestDigest, ":", "-", 1) + ".sig"
+	signatures, err := c.GetManifest(ctx, repository, signatureTag, c.verbose)
+	if err != nil {
+		return fmt.Errorf("fetching signatures for %s: %w", manifestDigest, err)
+	}
+
+	var errs []error
+	for _, layer := range signatures.Layers {
+		encoded, found := layer.Annotations[cosignSignatureAnnotation]
+		if !found {
+			continue
+		}
+		if err := c.verifySignatureLayer(ctx, repository, manifestDigest, layer, encoded, key); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if c.verbose {
+			fmt.Printf("Valid signature for %s in %s\n", manifestDigest, layer.Digest)
+		}
+		return nil
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("no signatures found for %s", manifestDigest)
+	}
+	return fmt.Errorf("no valid signature for %s: %w", manifestDigest, errors.Join(errs...))
+}
+
+// verifySignatureLayer downloads the signed payload of one signature layer and verifies it
+func (c *Client) verifySignatureLayer(ctx context.Context, repository, manifestDigest string, layer Layer, encodedSignature string, key crypto.PublicKey) error {
+	signature, err := base64.StdEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return fmt.Errorf("decoding signature in %s: %w", layer.Digest, err)
+	}
+	body, err := c.GetBlob(ctx, repository, layer.Digest)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	payload, err := io.ReadAll(io.LimitReader(body, maxSignaturePayloadSize))
+	if err != nil {
+		return fmt.Errorf("reading signature payload %s: %w", layer.Digest, err)
+	}
+	if digest := SHA256Digest(payload); digest != layer.Digest {
+		return fmt.Errorf("signature payload %s has digest %s", layer.Digest, digest)
+	}
+	if err := verifySignatureBytes(key, payload, signature); err != nil {
+		return fmt.Errorf("%s: %w", layer.Digest, err)
+	}
+	var p cosignPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("decoding signature payload %s: %w", layer.Digest, err)
+	}
+	if signed := p.Critical.Image.DockerManifestDigest; signed != manifestDigest {
+		return fmt.Errorf("%s signs %s, not %s", layer.Digest, signed, manifestDigest)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package ollamaurl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxTagPages is the most pages of tags that are followed, in case a registry links in a circle
+const maxTagPages = 1000
+
+// TagList is the response of the tags/list endpoint
+type TagList struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+// ListTags returns the tags of a repository. Registries that split the list into pages
+// link to the next one in the Link header, and every page is fetched.
+func (c *Client) ListTags(ctx context.Context, repository string) (*TagList, error) {
+	return c.listTags(ctx, c.registryFor(repository), repository)
+}
+
+// listTags returns the tags of a repository on the given registry
+func (c *Client) listTags(ctx context.Context, base *url.URL, repository string) (*TagList, error) {
+	next := resolveRegistryPath(base, "v2", repository, "tags", "list")
+	list := &TagList{Tags: []string{}}
+	for page := 0; next != ""; page++ {
+		if page >= maxTagPages {
+			return nil, fmt.Errorf("the tags of %s have more than %d pages", repository, maxTagPages)
+		}
+		var err error
+		next, err = c.getTagPage(ctx, next, list)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+// getTagPage fetches one page of tags and adds it to list. It returns the URL of the next
+// page, or "" if this was the last one.
+func (c *Client) getTagPage(ctx context.Context, pageURL string, list *TagList) (string, error) {
+	if c.verbose {
+		fmt.Printf("Fetching tags from: %s\n", pageURL)
+	}
+	req, err := c.NewRequest(ctx, http.MethodGet, pageURL)
+	if err != nil {
+		return "", fmt.Errorf("creating HTTP request: %w", err)
+	}
+	resp, err := c.doWithRetries(req, c.manifestRetries)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if err := checkChallenge(resp); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("failed to list tags: %s", resp.Status)
+	}
+	var page TagList
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return "", fmt.Errorf("decoding tags JSON: %w", err)
+	}
+	list.Name = page.Name
+	list.Tags = append(list.Tags, page.Tags...)
+	return nextPageURL(pageURL, resp.Header.Get("Link"))
+}
+
+// nextPageURL finds the rel="next" link in a Link header, like </v2/x/tags/list?n=100&last=b>; rel="next",
+// and resolves it against the URL of the current page
+func nextPageURL(pageURL, link string) (string, error) {
+	for _, part := range strings.Split(link, ",") {
+		target, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		target = strings.TrimSpace(target)
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		isNext := false
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "rel") && strings.EqualFold(strings.Trim(value, `"`), "next") {
+				isNext = true
+			}
+		}
+		if !isNext {
+			continue
+		}
+		current, err := url.Parse(pageURL)
+		if err != nil {
+			return "", err
+		}
+		nextURL, err := current.Parse(strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">"))
+		if err != nil {
+			return "", fmt.Errorf("invalid Link header %q: %w", link, err)
+		}
+		return nextURL.String(), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,56 @@
+package ollamaurl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrDigestMismatch is returned, wrapped, when a blob does not match its digest.
+// Custom verifiers should wrap it too, so that --retry-on-verify-failure works.
+var ErrDigestMismatch = errors.New("digest mismatch")
+
+// Verifier checks downloaded blobs. Verify must read r until the end, and
+// return an error if the data does not match the digest.
+type Verifier interface {
+	Verify(digest string, r io.Reader) error
+}
+
+// SHA256Verifier is the default Verifier, which hashes the data with sha256
+type SHA256Verifier struct{}
+
+// Verify checks that r has the given sha256 digest
+func (SHA256Verifier) Verify(digest string, r io.Reader) error {
+	if err := ValidateDigest(digest); err != nil {
+		return err
+	}
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, r); err != nil {
+		return err
+	}
+	if actual := "sha256:" + hex.EncodeToString(hasher.Sum(nil)); actual != digest {
+		return fmt.Errorf("%w for blob %s: got %s", ErrDigestMismatch, digest, actual)
+	}
+	return nil
+}
+
+// SetVerifier replaces the Verifier that DownloadBlob uses. A nil verifier restores the default.
+func (c *Client) SetVerifier(v Verifier) {
+	c.verifier = v
+}
+
+// VerifyBlob checks data that has already been downloaded with the Verifier of the client,
+// like the whole file after a resumed download
+func (c *Client) VerifyBlob(digest string, r io.Reader) error {
+	return c.blobVerifier().Verify(digest, r)
+}
+
+// blobVerifier returns the Verifier for downloaded blobs
+func (c *Client) blobVerifier() Verifier {
+	if c.verifier == nil {
+		return SHA256Verifier{}
+	}
+	return c.verifier
+}